@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+
+	bl "git.f-i-ts.de/cloud-native/metal/metal-hammer/pkg/bootloader"
+	log "github.com/inconshreveable/log15"
+)
+
+// efiFirmwarePath is present whenever the machine booted in UEFI mode.
+const efiFirmwarePath = "/sys/firmware/efi"
+
+// isEFI reports whether metal-hammer itself was booted via UEFI.
+func isEFI() bool {
+	_, err := os.Stat(efiFirmwarePath)
+	return err == nil
+}
+
+// bootloaderDisk converts the internal Disk/Partition representation,
+// which carries an arbitrary GPTType, into the role-based view the
+// pkg/bootloader strategies operate on.
+func bootloaderDisk(d Disk) bl.Disk {
+	partitions := make([]bl.Partition, 0, len(d.Partitions))
+	for _, p := range d.Partitions {
+		partitions = append(partitions, bl.Partition{
+			Device:     p.Device,
+			Role:       partitionRole(p),
+			MountPoint: p.MountPoint,
+			Number:     p.Number,
+		})
+	}
+	return bl.Disk{Device: d.Device, Partitions: partitions}
+}
+
+// partitionRole returns the bl.PartitionRole for p, preferring the
+// operator-declared PartitionConfig.Role carried on p.Role. Partitions with
+// no declared Role (synthetic raid/lvm disks, or layouts that never adopted
+// the VolumeConfig schema) fall back to deriving one from GPTType/MountPoint.
+func partitionRole(p *Partition) bl.PartitionRole {
+	switch p.Role {
+	case RolePartitionEFI:
+		return bl.RoleEFI
+	case RolePartitionBoot:
+		return bl.RoleBoot
+	case RolePartitionRoot:
+		return bl.RoleRoot
+	case "":
+		// no declared role, fall through to the legacy heuristics below
+	default:
+		return bl.PartitionRole(p.Role)
+	}
+
+	switch {
+	case p.GPTType == GPTBoot:
+		return bl.RoleEFI
+	case p.MountPoint == "/":
+		return bl.RoleRoot
+	case p.MountPoint == "/boot":
+		return bl.RoleBoot
+	default:
+		return bl.PartitionRole(p.Label)
+	}
+}
+
+// bootDisk returns the disk that carries the EFI or root partition, i.e.
+// the disk the bootloader must be installed to.
+func bootDisk(disks []Disk) (Disk, error) {
+	for _, d := range disks {
+		for _, p := range d.Partitions {
+			if p.GPTType == GPTBoot || p.MountPoint == "/" {
+				return d, nil
+			}
+		}
+	}
+	return Disk{}, fmt.Errorf("bootloader: no disk with an efi or root partition found")
+}
+
+// installBootloader selects a Bootloader strategy for disks and installs it,
+// deriving kernelArgs from the legacy /etc/metal/kernel-arguments file the
+// provisioner may have written.
+func installBootloader(prefix string, disks []Disk, override string) error {
+	disk, err := bootDisk(disks)
+	if err != nil {
+		return err
+	}
+
+	strategy, err := bl.Select(override, isEFI(), bootloaderDisk(disk))
+	if err != nil {
+		return fmt.Errorf("bootloader: select strategy failed: %v", err)
+	}
+
+	bd := bootloaderDisk(disk)
+
+	installed, err := strategy.Probe(bd, prefix)
+	if err != nil {
+		log.Warn("bootloader: probe failed, installing anyway", "error", err)
+	} else if installed {
+		log.Info("bootloader already installed, skipping", "disk", disk.Device)
+		return nil
+	}
+
+	kernelArgs := readKernelArguments(prefix)
+
+	log.Info("install bootloader", "disk", disk.Device)
+	err = strategy.Install(bd, prefix, kernelArgs)
+	if err != nil {
+		return fmt.Errorf("bootloader: install failed: %v", err)
+	}
+	return nil
+}
+
+// readKernelArguments reads the kernel arguments the provisioner may have
+// written to etc/metal/kernel-arguments, returning nil if absent.
+func readKernelArguments(prefix string) []string {
+	content, err := ioutil.ReadFile(prefix + "/etc/metal/kernel-arguments")
+	if err != nil || len(content) == 0 {
+		return nil
+	}
+	return strings.Fields(string(content))
+}
+
+// mountPartitionsForReinstall mounts the existing partitions of disks under
+// prefix without formatting them, "/" first so nested mountpoints work.
+func mountPartitionsForReinstall(prefix string, disks []Disk) error {
+	for _, d := range disks {
+		for _, p := range d.SortByMountPoint() {
+			if p.MountPoint == "" {
+				continue
+			}
+			mountPoint := prefix + p.MountPoint
+			err := os.MkdirAll(mountPoint, os.ModePerm)
+			if err != nil {
+				return fmt.Errorf("bootloader: create directory %s failed: %v", mountPoint, err)
+			}
+			log.Info("mount partition", "partition", p.Device, "mountPoint", mountPoint)
+			err = syscall.Mount(p.Device, mountPoint, string(p.Filesystem), 0, "")
+			if err != nil {
+				return fmt.Errorf("bootloader: mount %s to %s failed: %v", p.Device, mountPoint, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ReinstallBootloader re-installs the bootloader of an already installed
+// machine, independent of a full image install. Unlike a full install it
+// only resolves the existing disk/partition layout, it never wipes or
+// (re-)creates partitions.
+//
+// NOTE: this is the library-level entry point for a --reinstall-bootloader
+// mode; no main.go/CLI entrypoint exists anywhere in this snapshot to wire
+// a flag into yet, so nothing calls this function today.
+func ReinstallBootloader(vc VolumeConfig, diskSelector string, override string) error {
+	disks, err := resolveDisks(vc, diskSelector)
+	if err != nil {
+		return err
+	}
+
+	err = mountPartitionsForReinstall(prefix, disks)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, d := range disks {
+			for _, p := range d.Partitions {
+				if p.MountPoint == "" {
+					continue
+				}
+				mountPoint := prefix + p.MountPoint
+				log.Info("unmounting", "mountpoint", mountPoint)
+				err := syscall.Unmount(mountPoint, syscall.MNT_FORCE)
+				if err != nil {
+					log.Error("unable to umount", "path", mountPoint, "error", err)
+				}
+			}
+		}
+	}()
+
+	return installBootloader(prefix, disks, override)
+}
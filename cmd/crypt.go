@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// fetchLUKSKey resolves the key material cfg points at.
+func fetchLUKSKey(h *Hammer, cfg *LUKSConfig) ([]byte, error) {
+	switch cfg.KeySource {
+	case LUKSKeyFromDeviceSecret:
+		url := fmt.Sprintf("http://%s/device/%s/secret", h.Spec.MetalCoreURL, h.Spec.DeviceUUID)
+		resp, err := http.Get(url)
+		if err != nil {
+			return nil, fmt.Errorf("fetch luks device secret from %s failed: %v", url, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetch luks device secret from %s failed with status: %s", url, resp.Status)
+		}
+		return ioutil.ReadAll(resp.Body)
+	case LUKSKeyFromTPM2:
+		pcrs := make([]string, 0, len(cfg.PCRs))
+		for _, p := range cfg.PCRs {
+			pcrs = append(pcrs, strconv.Itoa(p))
+		}
+		args := []string{"unseal", "--pcr-list", strings.Join(pcrs, ",")}
+		out, err := exec.Command("tpm2_unseal", args...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("tpm2_unseal with pcrs %v failed: %v", cfg.PCRs, err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unknown luks key source: %s", cfg.KeySource)
+	}
+}
+
+// luksFormatAndOpen LUKS2-formats device with the key resolved from cfg,
+// opens it under name, and returns the resulting /dev/mapper path.
+func luksFormatAndOpen(h *Hammer, device, name string, cfg *LUKSConfig) (string, error) {
+	key, err := fetchLUKSKey(h, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	format := exec.Command("cryptsetup", "luksFormat", "--type", "luks2", "--batch-mode", "--key-file=-", device)
+	format.Stdin = bytes.NewReader(key)
+	out, err := format.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("cryptsetup luksFormat %s failed: %v, output: %s", device, err, string(out))
+	}
+
+	open := exec.Command("cryptsetup", "luksOpen", "--key-file=-", device, name)
+	open.Stdin = bytes.NewReader(key)
+	out, err = open.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("cryptsetup luksOpen %s failed: %v, output: %s", device, err, string(out))
+	}
+
+	return "/dev/mapper/" + name, nil
+}
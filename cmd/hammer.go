@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"time"
+
+	rp "git.f-i-ts.de/cloud-native/metal/metal-hammer/pkg/report"
+)
+
+// Hammer carries the state shared across the install/report/network-discovery
+// steps of a single device's run.
+//
+// NOTE: LLDPClient's own type, NewLLDPClient and LLDPTxIntervalTimeout are
+// referenced by cmd/interfaces.go but are not defined anywhere in this
+// snapshot (not even in the original baseline before this series) - that gap
+// predates and is not addressed here.
+type Hammer struct {
+	// Spec holds the application configuration this run was started with.
+	Spec Specification
+	// IPAddress this machine was reached at during the install.
+	IPAddress string
+	// Started is when metal-hammer began waiting for installation.
+	Started time.Time
+	// LLDPClient collects lldp neighbor information discovered on the
+	// uplink interfaces brought up by UpAllInterfaces.
+	LLDPClient *LLDPClient
+	// Report streams install-progress and events back to metal-core.
+	Report *rp.Client
+}
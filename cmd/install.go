@@ -3,6 +3,7 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -16,38 +17,14 @@ import (
 
 	"git.f-i-ts.de/cloud-native/metal/metal-hammer/metal-core/models"
 	"git.f-i-ts.de/cloud-native/metal/metal-hammer/pkg"
+	img "git.f-i-ts.de/cloud-native/metal/metal-hammer/pkg/image"
+	"git.f-i-ts.de/cloud-native/metal/metal-hammer/pkg/provision"
+	rp "git.f-i-ts.de/cloud-native/metal/metal-hammer/pkg/report"
 	log "github.com/inconshreveable/log15"
 	"github.com/mholt/archiver"
-	lz4 "github.com/pierrec/lz4"
-	pb "gopkg.in/cheggaaa/pb.v1"
 	"gopkg.in/yaml.v2"
 )
 
-var (
-	defaultDisk = Disk{
-		Device: "/dev/sda",
-		Partitions: []*Partition{
-			&Partition{
-				Label:      "efi",
-				Number:     1,
-				MountPoint: "/boot/efi",
-				Filesystem: VFAT,
-				GPTType:    GPTBoot,
-				GPTGuid:    EFISystemPartition,
-				Size:       300,
-			},
-			&Partition{
-				Label:      "root",
-				Number:     2,
-				MountPoint: "/",
-				Filesystem: EXT4,
-				GPTType:    GPTLinux,
-				Size:       -1,
-			},
-		},
-	}
-)
-
 const (
 	// FAT32 is used for the UEFI boot partition
 	FAT32 = FSType("fat32")
@@ -84,7 +61,12 @@ type FSType string
 
 // Partition defines a disk partition
 type Partition struct {
-	Label        string
+	Label string
+	// Role is the operator-declared purpose of this partition, as set by
+	// PartitionConfig.Role. Empty for partitions not built from a
+	// VolumeConfig (e.g. the synthetic raid/lvm disks provisionRaid/
+	// provisionLVM fold in), which callers derive a role for by other means.
+	Role         PartitionRole
 	Device       string
 	Number       uint
 	MountPoint   string
@@ -95,6 +77,9 @@ type Partition struct {
 	Filesystem FSType
 	GPTType    GPTType
 	GPTGuid    GPTGuid
+	// LUKS, when set, encrypts this partition; Device is rewritten to the
+	// unlocked /dev/mapper/<label> path once provisionCrypt has run.
+	LUKS *LUKSConfig
 }
 
 func (p *Partition) String() string {
@@ -120,17 +105,42 @@ type InstallerConfig struct {
 	IPAddress string `yaml:"ipaddress"`
 	// must be calculated from the last 4 byte of the IPAddress
 	ASN string `yaml:"asn"`
+	// Disks is the resolved volume layout, so install.sh does not have to
+	// redo the disk/partition matching metal-hammer already performed.
+	Disks []ResolvedDisk `yaml:"disks"`
 }
 
-// init set calculated Device of every partition
-func init() {
-	for _, p := range defaultDisk.Partitions {
-		p.Device = fmt.Sprintf("%s%d", defaultDisk.Device, p.Number)
-	}
+// ResolvedDisk is the final, matcher-resolved disk/partition layout written
+// to install.yaml for consumption by install.sh.
+type ResolvedDisk struct {
+	Device     string              `yaml:"device"`
+	Partitions []ResolvedPartition `yaml:"partitions"`
+}
+
+// ResolvedPartition is a single partition of a ResolvedDisk.
+type ResolvedPartition struct {
+	Device     string `yaml:"device"`
+	Label      string `yaml:"label"`
+	MountPoint string `yaml:"mountpoint"`
+	Filesystem string `yaml:"filesystem"`
+}
+
+// deviceInstallResponse wraps the generated metal-core device response with
+// the declarative volume layout metal-core may additionally deliver. It is
+// kept separate from models.ModelsMetalDeviceWithPhoneHomeToken so it does
+// not have to wait for that generated type to catch up.
+type deviceInstallResponse struct {
+	models.ModelsMetalDeviceWithPhoneHomeToken
+	VolumeConfig       *VolumeConfig     `json:"volumeConfig,omitempty"`
+	ProvisionConfig    *provision.Config `json:"provisionConfig,omitempty"`
+	BootloaderOverride string            `json:"bootloaderOverride,omitempty"`
 }
 
 // Wait until a device create request was fired
-func (h *Hammer) Wait(uuid string) (*models.ModelsMetalDeviceWithPhoneHomeToken, error) {
+func (h *Hammer) Wait(uuid string) (*models.ModelsMetalDeviceWithPhoneHomeToken, *VolumeConfig, *provision.Config, string, error) {
+	h.initReport()
+	h.Report.StageStarted(rp.StageWait)
+
 	e := fmt.Sprintf("http://%v/device/install/%v", h.Spec.MetalCoreURL, uuid)
 	log.Info("waiting for install, long polling", "url", e, "uuid", uuid)
 
@@ -148,50 +158,88 @@ func (h *Hammer) Wait(uuid string) (*models.ModelsMetalDeviceWithPhoneHomeToken,
 
 	deviceJSON, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("wait for install reading response failed with: %v", err)
+		return nil, nil, nil, "", fmt.Errorf("wait for install reading response failed with: %v", err)
 	}
 
-	var deviceWithToken models.ModelsMetalDeviceWithPhoneHomeToken
-	err = json.Unmarshal(deviceJSON, &deviceWithToken)
+	var deviceResponse deviceInstallResponse
+	err = json.Unmarshal(deviceJSON, &deviceResponse)
 	if err != nil {
-		return nil, fmt.Errorf("wait for install could not unmarshal response with error: %v", err)
+		return nil, nil, nil, "", fmt.Errorf("wait for install could not unmarshal response with error: %v", err)
 	}
-	log.Info("stopped waiting got", "deviceWithToken", deviceWithToken)
+	log.Info("stopped waiting got", "deviceWithToken", deviceResponse.ModelsMetalDeviceWithPhoneHomeToken)
+	h.Report.StageFinished(rp.StageWait)
 
-	return &deviceWithToken, nil
+	return &deviceResponse.ModelsMetalDeviceWithPhoneHomeToken, deviceResponse.VolumeConfig, deviceResponse.ProvisionConfig, deviceResponse.BootloaderOverride, nil
 }
 
 // Install a given image to the disk by using genuinetools/img
-func Install(deviceWithToken *models.ModelsMetalDeviceWithPhoneHomeToken) (*pkg.Bootinfo, error) {
+func (h *Hammer) Install(deviceWithToken *models.ModelsMetalDeviceWithPhoneHomeToken, volumeConfig *VolumeConfig, provisionConfig *provision.Config, bootloaderOverride string) (*pkg.Bootinfo, error) {
+	h.initReport()
+
 	device := deviceWithToken.Device
 	phtoken := deviceWithToken.PhoneHomeToken
 	image := *device.Image.URL
-	err := partition(defaultDisk)
+
+	// pull and verify before any partition is touched, so an unverifiable
+	// image never gets the chance to destroy the disk it would have been
+	// written to.
+	err := reportStage(h, rp.StagePull, func() error {
+		return pull(h, image)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	err = mountPartitions(prefix, defaultDisk)
+	vc := defaultVolumeConfig
+	if volumeConfig != nil {
+		vc = *volumeConfig
+	}
+
+	var disks []Disk
+	err = reportStage(h, rp.StagePartition, func() error {
+		var err error
+		disks, err = provisionVolumes(h, vc, prefix, h.Spec.InstallDiskSelector)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	err = pull(image)
+	if vc.DryRun {
+		log.Info("dry-run requested, skipping burn and install")
+		return nil, nil
+	}
+
+	err = mountPartitionsOf(prefix, disks)
 	if err != nil {
 		return nil, err
 	}
-	err = burn(prefix, image)
+
+	err = reportStage(h, rp.StageBurn, func() error {
+		return burn(h, prefix, image)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	info, err := install(prefix, device, *phtoken)
+	info, err := install(h, prefix, device, *phtoken, disks, provisionConfig, bootloaderOverride)
 	if err != nil {
 		return nil, err
 	}
 	return info, nil
 }
 
+// mountPartitionsOf mounts every partition of every given disk under prefix.
+func mountPartitionsOf(prefix string, disks []Disk) error {
+	for _, d := range disks {
+		err := mountPartitions(prefix, d)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func mountPartitions(prefix string, disk Disk) error {
 	log.Info("mount disk", "disk", disk)
 	// "/" must be mounted first
@@ -242,33 +290,121 @@ func (d *Disk) SortByMountPoint() []*Partition {
 	return ordered
 }
 
-// pull a image from s3
-func pull(image string) error {
+// pull an image through the ImageSource resolved from its url and verify it
+// before it is handed to burn.
+func pull(h *Hammer, image string) error {
 	log.Info("pull image", "image", image)
 	destination := osImageDestination
-	md5destination := destination + ".md5"
-	md5file := image + ".md5"
-	err := download(image, destination)
+
+	source, err := img.ResolveSource(image)
 	if err != nil {
 		return fmt.Errorf("unable to pull image %s error: %v", image, err)
 	}
-	err = download(md5file, md5destination)
-	defer os.Remove(md5destination)
+
+	reader, err := source.Open(image)
 	if err != nil {
-		return fmt.Errorf("unable to pull md5 %s error: %v", md5file, err)
+		return fmt.Errorf("unable to pull image %s error: %v", image, err)
 	}
-	log.Info("check md5")
-	matches, err := checkMD5(destination, md5destination)
-	if err != nil || !matches {
-		return fmt.Errorf("md5sum mismatch %v", err)
+	defer reader.Close()
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return fmt.Errorf("unable to create %s error: %v", destination, err)
+	}
+	// total size of image is not known upfront for a streamed download
+	proxied := rp.NewProxyReader(reader, h.Report, rp.StagePull, 0)
+	_, err = io.Copy(out, proxied)
+	out.Close()
+	if err != nil {
+		return fmt.Errorf("unable to pull image %s error: %v", image, err)
+	}
+
+	err = verifyImage(&h.Spec, image, destination)
+	if err != nil {
+		return fmt.Errorf("unable to verify image %s error: %v", image, err)
 	}
 
 	log.Info("pull image done", "image", image)
 	return nil
 }
 
-// burn a image pulling a tarball and unpack to a specific directory
-func burn(prefix, image string) error {
+// sigSuffixes are tried, in order, against image to find a matching signature or bundle.
+var sigSuffixes = []string{".asc", ".cosign.bundle"}
+
+// verifyImage verifies destination against an image signature when pubkeys
+// are pinned, falling back to a plain sha256sum check otherwise. When
+// spec.RequireSignature is set an unverifiable image is a hard error.
+func verifyImage(spec *Specification, image, destination string) error {
+	if len(spec.ImagePubKeys) == 0 {
+		if spec.RequireSignature {
+			return fmt.Errorf("signature required but no ImagePubKeys are configured")
+		}
+		return checkSHA256Fallback(image, destination)
+	}
+
+	verifiers := []img.Verifier{
+		&img.GPGVerifier{PubKeys: spec.ImagePubKeys},
+		&img.CosignVerifier{PubKeys: spec.ImagePubKeys},
+	}
+
+	var lastErr error
+	for i, v := range verifiers {
+		f, err := os.Open(destination)
+		if err != nil {
+			return err
+		}
+		err = v.Verify(f, image+sigSuffixes[i])
+		f.Close()
+		if err == nil {
+			log.Info("image signature verified", "image", image)
+			return nil
+		}
+		lastErr = err
+	}
+
+	if spec.RequireSignature {
+		return fmt.Errorf("unable to verify image signature, aborting before any partition is touched: %v", lastErr)
+	}
+
+	log.Warn("unable to verify image signature, falling back to sha256sum check", "error", lastErr)
+	return checkSHA256Fallback(image, destination)
+}
+
+// checkSHA256Fallback replaces the previous md5-based integrity check.
+func checkSHA256Fallback(image, destination string) error {
+	sumsURL := image + ".sha256"
+	sumsDestination := destination + ".sha256"
+
+	source, err := img.ResolveSource(sumsURL)
+	if err != nil {
+		return err
+	}
+	reader, err := source.Open(sumsURL)
+	if err != nil {
+		return fmt.Errorf("unable to pull sha256sum %s error: %v", sumsURL, err)
+	}
+	defer reader.Close()
+
+	out, err := os.Create(sumsDestination)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, reader)
+	out.Close()
+	defer os.Remove(sumsDestination)
+	if err != nil {
+		return fmt.Errorf("unable to pull sha256sum %s error: %v", sumsURL, err)
+	}
+
+	matches, err := img.CheckSHA256(destination, sumsDestination)
+	if err != nil || !matches {
+		return fmt.Errorf("sha256sum mismatch %v", err)
+	}
+	return nil
+}
+
+// burn pulls a pre-downloaded, already verified image and unpacks it to prefix.
+func burn(h *Hammer, prefix, image string) error {
 	log.Info("burn image", "image", image)
 	begin := time.Now()
 	source := osImageDestination
@@ -285,32 +421,30 @@ func burn(prefix, image string) error {
 		return fmt.Errorf("unable to stat %s error: %v", source, err)
 	}
 
-	if !strings.HasSuffix(image, "lz4") {
-		return fmt.Errorf("unsupported image compression format of image:%s", image)
+	decompressor, reader, err := img.ResolveDecompressor(image, file)
+	if err != nil {
+		return fmt.Errorf("unable to burn image %s error: %v", source, err)
+	}
+	decompressed, err := decompressor.Decompress(reader)
+	if err != nil {
+		return fmt.Errorf("unable to burn image %s error: %v", source, err)
 	}
 
-	lz4Reader := lz4.NewReader(file)
-	log.Info("lz4", "size", lz4Reader.Header.Size)
-	creader := ioutil.NopCloser(lz4Reader)
-	// wild guess for lz4 compression ratio
-	// lz4 is a stream format and therefore the
-	// final size cannot be calculated upfront
-	csize := stat.Size() * 2
-	defer creader.Close()
-
-	bar := pb.New64(csize).SetUnits(pb.U_BYTES)
-	bar.Start()
-	bar.SetWidth(80)
-	bar.ShowSpeed = true
+	// wild guess for the compression ratio, these are stream formats and
+	// therefore the final size cannot be calculated upfront
+	total := stat.Size() * 2
+	progress := img.NewTerminalProgress(total)
+	progress.Start()
 
-	reader := bar.NewProxyReader(creader)
+	proxied := progress.NewProxyReader(decompressed)
+	proxied = rp.NewProxyReader(proxied, h.Report, rp.StageBurn, total)
 
-	err = archiver.Tar.Read(reader, prefix)
+	err = archiver.Tar.Read(proxied, prefix)
 	if err != nil {
 		return fmt.Errorf("unable to burn image %s error: %v", source, err)
 	}
 
-	bar.Finish()
+	progress.Finish()
 
 	err = os.Remove(source)
 	if err != nil {
@@ -331,7 +465,8 @@ type mount struct {
 
 // install will execute /install.sh in the pulled docker image which was extracted onto disk
 // to finish installation e.g. install mbr, grub, write network and filesystem config
-func install(prefix string, device *models.ModelsMetalDevice, phoneHomeToken string) (*pkg.Bootinfo, error) {
+// /install.sh is only run if present; the bootloader is installed by installBootloader afterwards.
+func install(h *Hammer, prefix string, device *models.ModelsMetalDevice, phoneHomeToken string, disks []Disk, provisionConfig *provision.Config, bootloaderOverride string) (*pkg.Bootinfo, error) {
 	log.Info("install image", "image", device.Image.URL)
 	mounts := []mount{
 		mount{source: "proc", target: "/proc", fstype: "proc", flags: 0, data: ""},
@@ -348,7 +483,7 @@ func install(prefix string, device *models.ModelsMetalDevice, phoneHomeToken str
 		}
 	}
 
-	err := writeInstallerConfig(device)
+	err := writeInstallerConfig(device, disks)
 	if err != nil {
 		return nil, fmt.Errorf("writing configuration install.yaml failed:%v", err)
 	}
@@ -358,40 +493,66 @@ func install(prefix string, device *models.ModelsMetalDevice, phoneHomeToken str
 		return nil, fmt.Errorf("writing phoneHome.jwt failed:%v", err)
 	}
 
-	log.Info("running /install.sh on", "prefix", prefix)
-	err = os.Chdir(prefix)
-	if err != nil {
-		return nil, fmt.Errorf("unable to chdir to: %s error:%v", prefix, err)
-	}
-	cmd := exec.Command("/install.sh")
-	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
-	// these syscalls are required to execute the command in a chroot env.
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Credential: &syscall.Credential{
-			Uid:    uint32(0),
-			Gid:    uint32(0),
-			Groups: []uint32{0},
-		},
-		Chroot: prefix,
-	}
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("running install.sh in chroot failed: %v", err)
+	if provisionConfig != nil {
+		log.Info("apply provisioning configuration", "prefix", prefix)
+		err = provisionConfig.Apply(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("applying provisioning configuration failed: %v", err)
+		}
 	}
 
-	err = os.Chdir("/")
-	if err != nil {
-		return nil, fmt.Errorf("unable to chdir to: / error:%v", err)
+	installScript := path.Join(prefix, "install.sh")
+	if _, err := os.Stat(installScript); err == nil {
+		err = reportStage(h, rp.StageInstallSh, func() error {
+			log.Info("running /install.sh on", "prefix", prefix)
+			err := os.Chdir(prefix)
+			if err != nil {
+				return fmt.Errorf("unable to chdir to: %s error:%v", prefix, err)
+			}
+			cmd := exec.Command("/install.sh")
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+			// these syscalls are required to execute the command in a chroot env.
+			cmd.SysProcAttr = &syscall.SysProcAttr{
+				Credential: &syscall.Credential{
+					Uid:    uint32(0),
+					Gid:    uint32(0),
+					Groups: []uint32{0},
+				},
+				Chroot: prefix,
+			}
+			if err := cmd.Run(); err != nil {
+				return fmt.Errorf("running install.sh in chroot failed: %v", err)
+			}
+
+			err = os.Chdir("/")
+			if err != nil {
+				return fmt.Errorf("unable to chdir to: / error:%v", err)
+			}
+			log.Info("finish running /install.sh")
+
+			err = os.Remove(installScript)
+			if err != nil {
+				log.Warn("unable to remove install.sh, ignoring...", "error", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		log.Info("no /install.sh present, relying on provisioning configuration only", "prefix", prefix)
 	}
-	log.Info("finish running /install.sh")
 
-	err = os.Remove(path.Join(prefix, "/install.sh"))
+	info, err := readBootInfo()
 	if err != nil {
-		log.Warn("unable to remove install.sh, ignoring...", "error", err)
+		return nil, fmt.Errorf("unable to read boot-info.yaml: %v", err)
 	}
 
-	info, err := readBootInfo()
+	err = reportStage(h, rp.StageBootloader, func() error {
+		return installBootloader(prefix, disks, bootloaderOverride)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("unable to read boot-info.yaml: %v", err)
+		return nil, err
 	}
 
 	files := []string{info.Kernel, info.Initrd}
@@ -427,7 +588,7 @@ func writePhoneHomeToken(phoneHomeToken string) error {
 	return ioutil.WriteFile(destination, []byte(phoneHomeToken), 0600)
 }
 
-func writeInstallerConfig(device *models.ModelsMetalDevice) error {
+func writeInstallerConfig(device *models.ModelsMetalDevice, disks []Disk) error {
 	log.Info("write installation configuration")
 	configdir := path.Join(prefix, "etc", "metal")
 	err := os.MkdirAll(configdir, 0755)
@@ -460,6 +621,7 @@ func writeInstallerConfig(device *models.ModelsMetalDevice) error {
 		SSHPublicKey: sshPubkeys,
 		IPAddress:    ipaddress,
 		ASN:          fmt.Sprintf("%d", asn),
+		Disks:        resolvedDisksOf(disks),
 	}
 	yamlContent, err := yaml.Marshal(y)
 	if err != nil {
@@ -469,6 +631,25 @@ func writeInstallerConfig(device *models.ModelsMetalDevice) error {
 	return ioutil.WriteFile(destination, yamlContent, 0600)
 }
 
+// resolvedDisksOf converts the internal Disk/Partition representation into
+// the flat shape written to install.yaml.
+func resolvedDisksOf(disks []Disk) []ResolvedDisk {
+	resolved := make([]ResolvedDisk, 0, len(disks))
+	for _, d := range disks {
+		partitions := make([]ResolvedPartition, 0, len(d.Partitions))
+		for _, p := range d.Partitions {
+			partitions = append(partitions, ResolvedPartition{
+				Device:     p.Device,
+				Label:      p.Label,
+				MountPoint: p.MountPoint,
+				Filesystem: string(p.Filesystem),
+			})
+		}
+		resolved = append(resolved, ResolvedDisk{Device: d.Device, Partitions: partitions})
+	}
+	return resolved
+}
+
 func readBootInfo() (*pkg.Bootinfo, error) {
 	bi, err := ioutil.ReadFile(path.Join(prefix, "etc", "metal", "boot-info.yaml"))
 	if err != nil {
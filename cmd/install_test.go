@@ -0,0 +1,12 @@
+package cmd
+
+import "testing"
+
+func TestVerifyImageRequiresSignatureWithoutPubKeys(t *testing.T) {
+	spec := &Specification{RequireSignature: true}
+
+	err := verifyImage(spec, "os-image.tar.gz", "/does/not/exist")
+	if err == nil {
+		t.Fatal("expected an error when RequireSignature is set without ImagePubKeys")
+	}
+}
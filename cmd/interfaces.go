@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"git.f-i-ts.de/cloud-native/metal/metal-hammer/metal-core/models"
 	"git.f-i-ts.de/cloud-native/metal/metal-hammer/pkg/lldp"
+	rp "git.f-i-ts.de/cloud-native/metal/metal-hammer/pkg/report"
 	"git.f-i-ts.de/cloud-native/metallib/version"
 	log "github.com/inconshreveable/log15"
 	"github.com/jaypipes/ghw"
@@ -17,6 +18,12 @@ import (
 // therefore neighbor discovery,
 // which is required to make all local mac's visible on the switch side.
 func (h *Hammer) UpAllInterfaces() error {
+	// neighbor discovery runs before a device-create request exists, i.e.
+	// before Wait()/Install() would otherwise open the reporting channel
+	// lazily, so open it here instead - without this, every h.Report.Neighbors
+	// call below is silently skipped by its own nil-check.
+	h.initReport()
+
 	net, err := ghw.Network()
 	if err != nil {
 		return fmt.Errorf("Error getting network info: %v", err)
@@ -47,6 +54,12 @@ func (h *Hammer) UpAllInterfaces() error {
 	h.LLDPClient = lc
 	go lc.Start()
 
+	if h.Report != nil {
+		for _, nic := range interfaces {
+			h.Report.Neighbors(nic, true, 0)
+		}
+	}
+
 	return nil
 }
 
@@ -70,10 +83,16 @@ func (h *Hammer) Neighbors(name string) ([]*models.ModelsMetalNic, error) {
 
 	for !host.done {
 		log.Info("not all lldp pdu's received, waiting...", "interface", name)
+		if h.Report != nil {
+			h.Report.Neighbors(name, true, len(host.neighbors[name]))
+		}
 		time.Sleep(1 * time.Second)
 
 		duration := time.Now().Sub(host.start)
 		if duration > LLDPTxIntervalTimeout {
+			if h.Report != nil {
+				h.Report.Failure(rp.StageWait, fmt.Errorf("not all neighbor requirements where met within: %s on %s", LLDPTxIntervalTimeout, name), true)
+			}
 			return nil, fmt.Errorf("not all neighbor requirements where met within: %s, exiting", LLDPTxIntervalTimeout)
 		}
 	}
@@ -87,5 +106,10 @@ func (h *Hammer) Neighbors(name string) ([]*models.ModelsMetalNic, error) {
 		macAddress := neigh.Port.Value
 		neighbors = append(neighbors, &models.ModelsMetalNic{Mac: &macAddress})
 	}
+
+	if h.Report != nil {
+		h.Report.Neighbors(name, false, len(neighbors))
+	}
+
 	return neighbors, nil
 }
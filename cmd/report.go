@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	rp "git.f-i-ts.de/cloud-native/metal/metal-hammer/pkg/report"
+)
+
+// initReport opens the long-lived reporting channel to metal-core for this
+// device, if one is not already open.
+func (h *Hammer) initReport() {
+	if h.Report != nil {
+		return
+	}
+	h.Report = rp.NewClient(h.Spec.MetalCoreURL, h.Spec.DeviceUUID)
+	h.Report.Start()
+}
+
+// reportStage runs fn, reporting StageStarted/StageFinished/Failure to
+// metal-core around it. Reporting is best-effort: h.Report is nil before
+// initReport is called, and a failure to reach metal-core never blocks fn.
+func reportStage(h *Hammer, stage rp.Stage, fn func() error) error {
+	if h.Report != nil {
+		h.Report.StageStarted(stage)
+	}
+	err := fn()
+	if err != nil {
+		if h.Report != nil {
+			h.Report.Failure(stage, err, true)
+		}
+		return err
+	}
+	if h.Report != nil {
+		h.Report.StageFinished(stage)
+	}
+	return nil
+}
@@ -4,12 +4,14 @@ import (
 	log "github.com/inconshreveable/log15"
 )
 
-//Specification defines configuration items of the application
+// Specification defines configuration items of the application
 type Specification struct {
 	// Debug turn on debug log
 	Debug bool
 	// MetalCoreURL is the endpoint URL where the metalcore reside
 	MetalCoreURL string
+	// DeviceUUID identifies this machine to metal-core
+	DeviceUUID string
 	// ImageURL if given grabs a fixed OS image to install, only suitable in DevMode
 	ImageURL string
 	// DevMode turn on devmode which prevents failing in some situations
@@ -18,6 +20,14 @@ type Specification struct {
 	BGPEnabled bool
 	// Cidr of BGP interface in DEV Mode
 	Cidr string
+	// ImagePubKeys are armored GPG or PEM cosign public keys pinned to verify image signatures
+	ImagePubKeys []string
+	// RequireSignature aborts the install before any partition is touched if the image cannot be verified
+	RequireSignature bool
+	// InstallDiskSelector pins autopart to a single /dev/disk/by-id or
+	// /dev/disk/by-path name, breaking ties when several candidates are
+	// otherwise equally suitable for install.
+	InstallDiskSelector string
 }
 
 // Log print configuration options
@@ -25,9 +35,12 @@ func (s *Specification) Log() {
 	log.Info("configuration",
 		"debug", s.Debug,
 		"metalCoreURL", s.MetalCoreURL,
+		"deviceuuid", s.DeviceUUID,
 		"imageURL", s.ImageURL,
 		"devmode", s.DevMode,
 		"bgpenabled", s.BGPEnabled,
 		"cidr", s.Cidr,
+		"requiresignature", s.RequireSignature,
+		"installdiskselector", s.InstallDiskSelector,
 	)
 }
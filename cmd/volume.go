@@ -0,0 +1,597 @@
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/jaypipes/ghw"
+)
+
+// PartitionRole describes the purpose of a partition within a VolumeConfig.
+type PartitionRole string
+
+const (
+	// RolePartitionEFI marks the EFI system partition
+	RolePartitionEFI = PartitionRole("efi")
+	// RolePartitionBoot marks a separate /boot partition
+	RolePartitionBoot = PartitionRole("boot")
+	// RolePartitionRoot marks the partition mounted at "/"
+	RolePartitionRoot = PartitionRole("root")
+	// RolePartitionData marks an additional data partition
+	RolePartitionData = PartitionRole("data")
+	// RolePartitionSwap marks a swap partition
+	RolePartitionSwap = PartitionRole("swap")
+)
+
+// DiskMatcher selects a physical disk a DiskConfig applies to.
+// Empty fields are ignored, all non-empty fields must match.
+type DiskMatcher struct {
+	// Model is matched against the disk model reported by ghw.Block()
+	Model string
+	// MinSize and MaxSize limit the disk size in bytes, 0 means unbounded
+	MinSize uint64
+	MaxSize uint64
+	// Rotational selects a spinning disk if true, a SSD/NVMe if false, any disk if nil
+	Rotational *bool
+	// ByID matches the stable /dev/disk/by-id or /dev/disk/by-path name of the candidate disk
+	ByID string
+}
+
+// FilesystemSpec describes how a partition is formatted and mounted.
+type FilesystemSpec struct {
+	Type         FSType
+	MkfsOptions  []string
+	MountPoint   string
+	MountOptions []*MountOption
+}
+
+// LUKSKeySource describes where the key to unlock a LUKS2 volume comes from.
+type LUKSKeySource string
+
+const (
+	// LUKSKeyFromDeviceSecret reads the key from the device-scoped secret delivered by metal-core
+	LUKSKeyFromDeviceSecret = LUKSKeySource("device-secret")
+	// LUKSKeyFromTPM2 unseals the key from a TPM2 PCR policy
+	LUKSKeyFromTPM2 = LUKSKeySource("tpm2-pcr")
+)
+
+// LUKSConfig enables LUKS2 encryption of the volume it is attached to.
+type LUKSConfig struct {
+	KeySource LUKSKeySource
+	// PCRs is only evaluated when KeySource is LUKSKeyFromTPM2
+	PCRs []int
+}
+
+// RaidLevel is a linux mdraid raid level.
+type RaidLevel string
+
+const (
+	// Raid0 stripes across all members
+	Raid0 = RaidLevel("0")
+	// Raid1 mirrors across all members
+	Raid1 = RaidLevel("1")
+	// Raid10 combines striping and mirroring
+	Raid10 = RaidLevel("10")
+)
+
+// RaidConfig combines partitions of one or more disks into a single mdadm
+// device, formatted and mounted like any other volume.
+type RaidConfig struct {
+	Name  string
+	Level RaidLevel
+	// Members references PartitionConfig.Label of the partitions to combine
+	Members    []string
+	LUKS       *LUKSConfig
+	Filesystem FilesystemSpec
+}
+
+// LVMConfig combines partitions of one or more disks into a volume group
+// and a single logical volume on top of it, formatted and mounted like any
+// other volume.
+type LVMConfig struct {
+	VolumeGroup   string
+	LogicalVolume string
+	// Members references PartitionConfig.Label of the partitions to combine
+	Members    []string
+	LUKS       *LUKSConfig
+	Filesystem FilesystemSpec
+}
+
+// PartitionConfig describes a single GPT partition to create on a matched disk.
+type PartitionConfig struct {
+	Label  string
+	Role   PartitionRole
+	Number uint
+	// Size in mebiBytes, -1 uses all remaining space on the disk
+	Size    int64
+	GPTType GPTType
+	GPTGuid GPTGuid
+
+	Filesystem FilesystemSpec
+	LUKS       *LUKSConfig
+}
+
+// DiskConfig describes the GPT layout applied to every disk matched by Matcher.
+type DiskConfig struct {
+	Matcher    DiskMatcher
+	Partitions []PartitionConfig
+}
+
+// VolumeConfig is the declarative disk/partition/raid/lvm layout fetched from
+// metal-core as part of the device response. If a device response does not
+// carry one, defaultVolumeConfig is used instead.
+type VolumeConfig struct {
+	Disks []DiskConfig
+	Raid  []RaidConfig
+	LVM   []LVMConfig
+	// DryRun logs the resolved plan without touching any disk
+	DryRun bool
+}
+
+// defaultVolumeConfig mirrors the legacy hardcoded defaultDisk layout and is
+// used whenever metal-core does not deliver a VolumeConfig of its own.
+var defaultVolumeConfig = VolumeConfig{
+	Disks: []DiskConfig{
+		{
+			Partitions: []PartitionConfig{
+				{
+					Label:      "efi",
+					Role:       RolePartitionEFI,
+					Number:     1,
+					Size:       300,
+					GPTType:    GPTBoot,
+					GPTGuid:    EFISystemPartition,
+					Filesystem: FilesystemSpec{Type: VFAT, MountPoint: "/boot/efi"},
+				},
+				{
+					Label:      "root",
+					Role:       RolePartitionRoot,
+					Number:     2,
+					Size:       -1,
+					GPTType:    GPTLinux,
+					Filesystem: FilesystemSpec{Type: EXT4, MountPoint: "/"},
+				},
+			},
+		},
+	},
+}
+
+// resolveDisks matches every DiskConfig.Matcher against the physical block
+// devices reported by ghw.Block() and returns one Disk per match. Matchers
+// are resolved in the order the DiskConfigs were declared in vc.Disks, the
+// returned Disks are sorted by device name. An empty
+// Matcher is resolved via autopartSelect instead of matchDisk, since matching
+// every block device would otherwise make the install target dependent on
+// enumeration order. It is an error for a matcher to resolve to zero or, for
+// a non-empty matcher, to more than one candidate.
+func resolveDisks(vc VolumeConfig, diskSelector string) ([]Disk, error) {
+	block, err := ghw.Block()
+	if err != nil {
+		return nil, fmt.Errorf("resolve disks: unable to read block devices: %v", err)
+	}
+
+	claimed := make(map[string]bool)
+	disks := make([]Disk, 0, len(vc.Disks))
+	for _, dc := range vc.Disks {
+		var device string
+		if dc.Matcher == (DiskMatcher{}) {
+			name, err := autopartSelect(block.Disks, claimed, diskSelector)
+			if err != nil {
+				return nil, err
+			}
+			device = "/dev/" + name
+		} else {
+			candidates := matchDisk(block.Disks, dc.Matcher, claimed)
+			if len(candidates) == 0 {
+				return nil, fmt.Errorf("resolve disks: no disk matched %+v", dc.Matcher)
+			}
+			if len(candidates) > 1 {
+				return nil, fmt.Errorf("resolve disks: matcher %+v is ambiguous, candidates: %v", dc.Matcher, candidates)
+			}
+			device = "/dev/" + candidates[0]
+		}
+		claimed[device] = true
+
+		partitions := make([]*Partition, 0, len(dc.Partitions))
+		for _, pc := range dc.Partitions {
+			partitions = append(partitions, newPartition(device, pc))
+		}
+		disks = append(disks, Disk{Device: device, Partitions: partitions})
+	}
+
+	// keep provisioning order stable across reruns regardless of enumeration order
+	sort.SliceStable(disks, func(i, j int) bool { return disks[i].Device < disks[j].Device })
+	return disks, nil
+}
+
+// newPartition builds a Partition for pc on device, deriving the partition's
+// own device node the same way the kernel names it (e.g. /dev/sda1,
+// /dev/nvme0n1p1).
+func newPartition(device string, pc PartitionConfig) *Partition {
+	sep := ""
+	if len(device) > 0 && device[len(device)-1] >= '0' && device[len(device)-1] <= '9' {
+		sep = "p"
+	}
+	return &Partition{
+		Label:        pc.Label,
+		Role:         pc.Role,
+		Device:       fmt.Sprintf("%s%s%d", device, sep, pc.Number),
+		Number:       pc.Number,
+		MountPoint:   pc.Filesystem.MountPoint,
+		MountOptions: pc.Filesystem.MountOptions,
+		Size:         pc.Size,
+		Filesystem:   pc.Filesystem.Type,
+		GPTType:      pc.GPTType,
+		GPTGuid:      pc.GPTGuid,
+		LUKS:         pc.LUKS,
+	}
+}
+
+// matchDisk returns the names of every unclaimed block device satisfying m.
+func matchDisk(blockDisks []*ghw.Disk, m DiskMatcher, claimed map[string]bool) []string {
+	names := make([]string, 0)
+	for _, d := range blockDisks {
+		device := "/dev/" + d.Name
+		if claimed[device] {
+			continue
+		}
+		if m.Model != "" && d.Model != m.Model {
+			continue
+		}
+		if m.MinSize != 0 && d.SizeBytes < m.MinSize {
+			continue
+		}
+		if m.MaxSize != 0 && d.SizeBytes > m.MaxSize {
+			continue
+		}
+		if m.Rotational != nil && (d.DriveType == ghw.DRIVE_TYPE_HDD) != *m.Rotational {
+			continue
+		}
+		if m.ByID != "" {
+			name, err := resolveDiskSelector(m.ByID)
+			if err != nil || name != d.Name {
+				continue
+			}
+		}
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// minAutopartDiskSize is the smallest disk autopartSelect will consider an
+// install target, 20GiB, matching typical minimal OS image sizes.
+const minAutopartDiskSize = 20 * 1024 * 1024 * 1024
+
+// autopartSelect picks a single unclaimed block device to install onto,
+// Anaconda-autopart style, when a DiskConfig does not pin a specific disk.
+// It prefers non-removable, non-USB devices, prefers NVMe over SATA/SCSI
+// when both meet minAutopartDiskSize, and skips devices below that
+// threshold entirely. Every candidate is logged with the reason it was
+// accepted or rejected. If more than one candidate remains tied after the
+// policy is applied, diskSelector (a /dev/disk/by-id or /dev/disk/by-path
+// name) must unambiguously pick one, or the install is refused.
+func autopartSelect(blockDisks []*ghw.Disk, claimed map[string]bool, diskSelector string) (string, error) {
+	type candidate struct {
+		disk *ghw.Disk
+		rank int
+	}
+	candidates := make([]candidate, 0)
+	for _, d := range blockDisks {
+		device := "/dev/" + d.Name
+		if claimed[device] {
+			log.Info("autopart candidate rejected", "disk", device, "reason", "already claimed by another DiskConfig")
+			continue
+		}
+		if d.IsRemovable {
+			log.Info("autopart candidate rejected", "disk", device, "reason", "removable device")
+			continue
+		}
+		if d.StorageController == ghw.STORAGE_CONTROLLER_USB {
+			log.Info("autopart candidate rejected", "disk", device, "reason", "USB attached device")
+			continue
+		}
+		if d.SizeBytes < minAutopartDiskSize {
+			log.Info("autopart candidate rejected", "disk", device, "reason", "smaller than minimum install size", "size", d.SizeBytes, "minimum", minAutopartDiskSize)
+			continue
+		}
+
+		// lower rank wins: NVMe is preferred over every other bus
+		rank := 1
+		if d.StorageController == ghw.STORAGE_CONTROLLER_NVME {
+			rank = 0
+		}
+		log.Info("autopart candidate accepted", "disk", device, "size", d.SizeBytes, "controller", d.StorageController, "rank", rank)
+		candidates = append(candidates, candidate{disk: d, rank: rank})
+	}
+
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("autopart: no suitable disk found")
+	}
+
+	bestRank := candidates[0].rank
+	for _, c := range candidates {
+		if c.rank < bestRank {
+			bestRank = c.rank
+		}
+	}
+	best := make([]candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if c.rank == bestRank {
+			best = append(best, c)
+		}
+	}
+
+	if len(best) == 1 {
+		return best[0].disk.Name, nil
+	}
+
+	if diskSelector == "" {
+		names := make([]string, 0, len(best))
+		for _, c := range best {
+			names = append(names, c.disk.Name)
+		}
+		return "", fmt.Errorf("autopart: %d disks tied for install target %v, pin Specification.InstallDiskSelector to a /dev/disk/by-id or /dev/disk/by-path name to disambiguate", len(best), names)
+	}
+
+	selectedName, err := resolveDiskSelector(diskSelector)
+	if err != nil {
+		return "", fmt.Errorf("autopart: unable to resolve InstallDiskSelector %s: %v", diskSelector, err)
+	}
+	for _, c := range best {
+		if c.disk.Name == selectedName {
+			return c.disk.Name, nil
+		}
+	}
+	return "", fmt.Errorf("autopart: InstallDiskSelector %s resolved to %s, which is not among the tied candidates", diskSelector, selectedName)
+}
+
+// resolveDiskSelector resolves a /dev/disk/by-id or /dev/disk/by-path
+// symlink (or any other symlink to a block device) down to the kernel
+// device name ghw.Block() reports, e.g. "sda" or "nvme0n1".
+func resolveDiskSelector(selector string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(selector)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(resolved), nil
+}
+
+// wipeDisks removes existing GPT and mdadm superblocks from every disk so
+// partitioning starts from a clean slate.
+func wipeDisks(disks []Disk, dryRun bool) error {
+	for _, d := range disks {
+		log.Info("wipe disk", "disk", d.Device)
+		if dryRun {
+			continue
+		}
+		out, err := exec.Command("wipefs", "-a", d.Device).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("wipe disk %s failed: %v, output: %s", d.Device, err, string(out))
+		}
+		out, err = exec.Command("mdadm", "--zero-superblock", "--force", d.Device).CombinedOutput()
+		if err != nil {
+			log.Warn("zero mdadm superblock failed, ignoring", "disk", d.Device, "error", err, "output", string(out))
+		}
+	}
+	return nil
+}
+
+// provisionVolumes resolves vc against the available block devices and
+// provisions disks, partitions, crypt volumes and raid/lvm groupings in
+// that order, folding the raid/lvm result back in as an ordinary Disk so a
+// single mount/filesystem/install.yaml pipeline handles plain partitions,
+// raid arrays and logical volumes alike. In dry-run mode the resolved plan
+// is logged but no disk is touched. diskSelector pins autopart to a single
+// by-id or by-path name, see Specification.InstallDiskSelector.
+func provisionVolumes(h *Hammer, vc VolumeConfig, prefix string, diskSelector string) ([]Disk, error) {
+	disks, err := resolveDisks(vc, diskSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("resolved volume plan", "dryRun", vc.DryRun)
+	for _, d := range disks {
+		log.Info("disk", "device", d.Device)
+		for _, p := range d.Partitions {
+			log.Info("partition", "disk", d.Device, "label", p.Label, "mountpoint", p.MountPoint, "fs", p.Filesystem)
+		}
+	}
+	for _, r := range vc.Raid {
+		log.Info("raid", "name", r.Name, "level", r.Level, "members", r.Members, "mountpoint", r.Filesystem.MountPoint)
+	}
+	for _, l := range vc.LVM {
+		log.Info("lvm", "vg", l.VolumeGroup, "lv", l.LogicalVolume, "members", l.Members, "mountpoint", l.Filesystem.MountPoint)
+	}
+
+	if vc.DryRun {
+		log.Info("dry-run, not touching any disk")
+		return disks, nil
+	}
+
+	err = wipeDisks(disks, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range disks {
+		err = partition(d)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// crypt member partitions before raid/lvm assembles them, so an
+	// encrypted-then-mirrored layout raids the unlocked mapper devices
+	// rather than the raw partitions.
+	err = provisionCrypt(h, disks)
+	if err != nil {
+		return nil, err
+	}
+
+	// raid and lvm groupings are combined after the member partitions exist,
+	// but before any filesystem is created on the resulting device. Each
+	// combined device is folded back into disks as a synthetic, single-
+	// partition Disk so mounting/formatting/install.yaml never has to know
+	// raid or lvm exist.
+	raidDisks, err := provisionRaid(h, vc.Raid, disks)
+	if err != nil {
+		return nil, err
+	}
+	disks = append(disks, raidDisks...)
+
+	lvmDisks, err := provisionLVM(h, vc.LVM, disks)
+	if err != nil {
+		return nil, err
+	}
+	disks = append(disks, lvmDisks...)
+
+	return disks, nil
+}
+
+// resolveMemberDevice returns the Device of the partition labeled label
+// across every disk already resolved, including raid/lvm disks folded in
+// by an earlier call to provisionRaid. It is an error for label to be
+// ambiguous or missing, so a typo in a RaidConfig/LVMConfig never silently
+// targets the wrong device.
+func resolveMemberDevice(label string, disks []Disk) (string, error) {
+	var found string
+	for _, d := range disks {
+		for _, p := range d.Partitions {
+			if p.Label != label {
+				continue
+			}
+			if found != "" && found != p.Device {
+				return "", fmt.Errorf("resolve member %s: ambiguous, matches both %s and %s", label, found, p.Device)
+			}
+			found = p.Device
+		}
+	}
+	if found == "" {
+		return "", fmt.Errorf("resolve member %s: no partition with that label", label)
+	}
+	return found, nil
+}
+
+// resolveMemberDevices resolves every label in members via resolveMemberDevice.
+func resolveMemberDevices(members []string, disks []Disk) ([]string, error) {
+	devices := make([]string, 0, len(members))
+	for _, label := range members {
+		device, err := resolveMemberDevice(label, disks)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// provisionCrypt LUKS2-formats and opens every partition that carries a
+// LUKS config, rewriting its Device in place to the unlocked
+// /dev/mapper/<label> path so every later step (raid/lvm assembly,
+// mkfs, mount) transparently operates on the decrypted block device.
+func provisionCrypt(h *Hammer, disks []Disk) error {
+	for _, d := range disks {
+		for _, p := range d.Partitions {
+			if p.LUKS == nil {
+				continue
+			}
+			mapped, err := luksFormatAndOpen(h, p.Device, p.Label, p.LUKS)
+			if err != nil {
+				return fmt.Errorf("crypt partition %s (%s) failed: %v", p.Label, p.Device, err)
+			}
+			p.Device = mapped
+		}
+	}
+	return nil
+}
+
+// provisionRaid assembles every configured mdadm array from its member
+// partitions, resolved by PartitionConfig.Label, optionally encrypts the
+// resulting array, and returns one synthetic, single-partition Disk per
+// RaidConfig carrying its configured Filesystem/mountpoint.
+func provisionRaid(h *Hammer, configs []RaidConfig, disks []Disk) ([]Disk, error) {
+	result := make([]Disk, 0, len(configs))
+	for _, r := range configs {
+		members, err := resolveMemberDevices(r.Members, disks)
+		if err != nil {
+			return nil, fmt.Errorf("assemble raid %s: %v", r.Name, err)
+		}
+
+		log.Info("assemble raid", "name", r.Name, "level", r.Level, "members", members)
+		mdDevice := "/dev/md/" + r.Name
+		args := append([]string{"--create", mdDevice, "--name=" + r.Name, "--level=" + string(r.Level), fmt.Sprintf("--raid-devices=%d", len(members))}, members...)
+		out, err := exec.Command("mdadm", args...).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("assemble raid %s failed: %v, output: %s", r.Name, err, string(out))
+		}
+
+		device := mdDevice
+		if r.LUKS != nil {
+			device, err = luksFormatAndOpen(h, mdDevice, r.Name, r.LUKS)
+			if err != nil {
+				return nil, fmt.Errorf("crypt raid %s failed: %v", r.Name, err)
+			}
+		}
+
+		result = append(result, Disk{
+			Device: device,
+			Partitions: []*Partition{{
+				Label:        r.Name,
+				Device:       device,
+				MountPoint:   r.Filesystem.MountPoint,
+				MountOptions: r.Filesystem.MountOptions,
+				Filesystem:   r.Filesystem.Type,
+			}},
+		})
+	}
+	return result, nil
+}
+
+// provisionLVM creates the configured volume groups and logical volumes
+// from their member partitions, resolved by PartitionConfig.Label,
+// optionally encrypts the resulting logical volume, and returns one
+// synthetic, single-partition Disk per LVMConfig carrying its configured
+// Filesystem/mountpoint.
+func provisionLVM(h *Hammer, configs []LVMConfig, disks []Disk) ([]Disk, error) {
+	result := make([]Disk, 0, len(configs))
+	for _, l := range configs {
+		members, err := resolveMemberDevices(l.Members, disks)
+		if err != nil {
+			return nil, fmt.Errorf("create lvm %s/%s: %v", l.VolumeGroup, l.LogicalVolume, err)
+		}
+
+		log.Info("create lvm", "vg", l.VolumeGroup, "lv", l.LogicalVolume, "members", members)
+		out, err := exec.Command("vgcreate", append([]string{l.VolumeGroup}, members...)...).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("vgcreate %s failed: %v, output: %s", l.VolumeGroup, err, string(out))
+		}
+		out, err = exec.Command("lvcreate", "-l", "100%FREE", "-n", l.LogicalVolume, l.VolumeGroup).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("lvcreate %s/%s failed: %v, output: %s", l.VolumeGroup, l.LogicalVolume, err, string(out))
+		}
+
+		lvDevice := fmt.Sprintf("/dev/%s/%s", l.VolumeGroup, l.LogicalVolume)
+		device := lvDevice
+		if l.LUKS != nil {
+			device, err = luksFormatAndOpen(h, lvDevice, l.LogicalVolume, l.LUKS)
+			if err != nil {
+				return nil, fmt.Errorf("crypt lvm %s/%s failed: %v", l.VolumeGroup, l.LogicalVolume, err)
+			}
+		}
+
+		result = append(result, Disk{
+			Device: device,
+			Partitions: []*Partition{{
+				Label:        l.LogicalVolume,
+				Device:       device,
+				MountPoint:   l.Filesystem.MountPoint,
+				MountOptions: l.Filesystem.MountOptions,
+				Filesystem:   l.Filesystem.Type,
+			}},
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jaypipes/ghw"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestMatchDisk(t *testing.T) {
+	disks := []*ghw.Disk{
+		{Name: "sda", Model: "ST1000", SizeBytes: 1000 * 1024 * 1024 * 1024, DriveType: ghw.DRIVE_TYPE_HDD},
+		{Name: "nvme0n1", Model: "Samsung SSD", SizeBytes: 500 * 1024 * 1024 * 1024, DriveType: ghw.DRIVE_TYPE_SSD},
+	}
+
+	t.Run("matches by minsize", func(t *testing.T) {
+		got := matchDisk(disks, DiskMatcher{MinSize: 900 * 1024 * 1024 * 1024}, map[string]bool{})
+		if len(got) != 1 || got[0] != "sda" {
+			t.Fatalf("expected only sda, got %v", got)
+		}
+	})
+
+	t.Run("matches by rotational", func(t *testing.T) {
+		got := matchDisk(disks, DiskMatcher{Rotational: boolPtr(false)}, map[string]bool{})
+		if len(got) != 1 || got[0] != "nvme0n1" {
+			t.Fatalf("expected only nvme0n1, got %v", got)
+		}
+	})
+
+	t.Run("excludes claimed disks", func(t *testing.T) {
+		got := matchDisk(disks, DiskMatcher{}, map[string]bool{"/dev/sda": true})
+		if len(got) != 1 || got[0] != "nvme0n1" {
+			t.Fatalf("expected only nvme0n1, got %v", got)
+		}
+	})
+
+	t.Run("no match returns empty", func(t *testing.T) {
+		got := matchDisk(disks, DiskMatcher{Model: "does-not-exist"}, map[string]bool{})
+		if len(got) != 0 {
+			t.Fatalf("expected no candidates, got %v", got)
+		}
+	})
+}
+
+func TestMatchDiskByID(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "sda")
+	if err := os.WriteFile(target, []byte("x"), 0644); err != nil {
+		t.Fatalf("create target failed: %v", err)
+	}
+	link := filepath.Join(dir, "wwn-0x5000")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("create symlink failed: %v", err)
+	}
+
+	disks := []*ghw.Disk{{Name: "sda", SizeBytes: 100}}
+	got := matchDisk(disks, DiskMatcher{ByID: link}, map[string]bool{})
+	if len(got) != 1 || got[0] != "sda" {
+		t.Fatalf("expected by-id symlink to resolve to sda, got %v", got)
+	}
+
+	got = matchDisk(disks, DiskMatcher{ByID: filepath.Join(dir, "does-not-exist")}, map[string]bool{})
+	if len(got) != 0 {
+		t.Fatalf("expected unresolvable by-id selector to match nothing, got %v", got)
+	}
+}
+
+func TestAutopartSelect(t *testing.T) {
+	small := uint64(10 * 1024 * 1024 * 1024)
+	big := uint64(100 * 1024 * 1024 * 1024)
+
+	disks := []*ghw.Disk{
+		{Name: "sdz", SizeBytes: big, IsRemovable: true},
+		{Name: "sda", SizeBytes: small},
+		{Name: "sdb", SizeBytes: big, StorageController: ghw.STORAGE_CONTROLLER_SCSI},
+		{Name: "nvme0n1", SizeBytes: big, StorageController: ghw.STORAGE_CONTROLLER_NVME},
+	}
+
+	got, err := autopartSelect(disks, map[string]bool{}, "")
+	if err != nil {
+		t.Fatalf("autopartSelect failed: %v", err)
+	}
+	if got != "nvme0n1" {
+		t.Fatalf("expected nvme0n1 to be preferred, got %s", got)
+	}
+}
+
+func TestAutopartSelectNoSuitableDisk(t *testing.T) {
+	disks := []*ghw.Disk{
+		{Name: "sda", SizeBytes: 1024, IsRemovable: true},
+	}
+	_, err := autopartSelect(disks, map[string]bool{}, "")
+	if err == nil {
+		t.Fatal("expected an error when no disk is suitable")
+	}
+}
+
+func TestAutopartSelectTieRequiresSelector(t *testing.T) {
+	big := uint64(100 * 1024 * 1024 * 1024)
+	disks := []*ghw.Disk{
+		{Name: "sda", SizeBytes: big, StorageController: ghw.STORAGE_CONTROLLER_SCSI},
+		{Name: "sdb", SizeBytes: big, StorageController: ghw.STORAGE_CONTROLLER_SCSI},
+	}
+
+	_, err := autopartSelect(disks, map[string]bool{}, "")
+	if err == nil {
+		t.Fatal("expected a tie between equally ranked disks to be refused without a selector")
+	}
+}
+
+func TestAutopartSelectTieBrokenBySelector(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "sdb")
+	if err := os.WriteFile(target, []byte("x"), 0644); err != nil {
+		t.Fatalf("create target failed: %v", err)
+	}
+	link := filepath.Join(dir, "by-path-pci-0")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("create symlink failed: %v", err)
+	}
+
+	big := uint64(100 * 1024 * 1024 * 1024)
+	disks := []*ghw.Disk{
+		{Name: "sda", SizeBytes: big, StorageController: ghw.STORAGE_CONTROLLER_SCSI},
+		{Name: "sdb", SizeBytes: big, StorageController: ghw.STORAGE_CONTROLLER_SCSI},
+	}
+
+	got, err := autopartSelect(disks, map[string]bool{}, link)
+	if err != nil {
+		t.Fatalf("autopartSelect with selector failed: %v", err)
+	}
+	if got != "sdb" {
+		t.Fatalf("expected selector to pick sdb, got %s", got)
+	}
+}
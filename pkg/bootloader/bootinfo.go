@@ -0,0 +1,26 @@
+package bootloader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"git.f-i-ts.de/cloud-native/metal/metal-hammer/pkg"
+	"gopkg.in/yaml.v2"
+)
+
+// readBootInfo reads the boot-info.yaml written by install.sh or the
+// provisioner, the same file cmd.readBootInfo reads after a legacy install.
+func readBootInfo(prefix string) (*pkg.Bootinfo, error) {
+	bi, err := ioutil.ReadFile(path.Join(prefix, "etc", "metal", "boot-info.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("bootloader: could not read boot-info.yaml: %v", err)
+	}
+
+	info := &pkg.Bootinfo{}
+	err = yaml.Unmarshal(bi, info)
+	if err != nil {
+		return nil, fmt.Errorf("bootloader: could not unmarshal boot-info.yaml: %v", err)
+	}
+	return info, nil
+}
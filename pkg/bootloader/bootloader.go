@@ -0,0 +1,92 @@
+// Package bootloader writes the bootloader directly to the target block
+// device from the installer environment, instead of delegating that step to
+// /install.sh inside the extracted rootfs.
+package bootloader
+
+import "fmt"
+
+// PartitionRole is the subset of disk-schema partition roles a Bootloader cares about.
+type PartitionRole string
+
+const (
+	// RoleEFI marks the EFI system partition
+	RoleEFI = PartitionRole("efi")
+	// RoleBoot marks a separate /boot partition
+	RoleBoot = PartitionRole("boot")
+	// RoleRoot marks the partition mounted at "/"
+	RoleRoot = PartitionRole("root")
+)
+
+// Partition is the minimal partition information a Bootloader needs.
+type Partition struct {
+	Device     string
+	Role       PartitionRole
+	MountPoint string
+	// Number is the partition's 1-based index on its disk, e.g. 1 for the
+	// first partition. Strategies that call out to tools addressing
+	// partitions by number (efibootmgr) need this instead of Device.
+	Number uint
+}
+
+// Disk is the minimal disk information a Bootloader needs.
+type Disk struct {
+	Device     string
+	Partitions []Partition
+}
+
+// ByRole returns the first partition with the given role, if any.
+func (d Disk) ByRole(role PartitionRole) (Partition, bool) {
+	for _, p := range d.Partitions {
+		if p.Role == role {
+			return p, true
+		}
+	}
+	return Partition{}, false
+}
+
+// Bootloader installs a bootloader directly onto disk and can probe whether
+// it is already installed there.
+type Bootloader interface {
+	// Install copies the bootloader binaries out of the rootfs at prefix,
+	// writes loader entries for the kernel/initrd found there and installs
+	// the bootloader onto disk.
+	Install(disk Disk, prefix string, kernelArgs []string) error
+	// Probe reports whether this Bootloader is already installed on disk,
+	// mounted under prefix the same way Install expects it.
+	Probe(disk Disk, prefix string) (bool, error)
+}
+
+// Strategy names, also accepted as an override in the device response.
+const (
+	StrategyGrub2EFI    = "grub2-efi"
+	StrategySystemdBoot = "systemd-boot"
+	StrategySyslinux    = "syslinux"
+)
+
+// Select picks the Bootloader strategy to use. override, when non-empty,
+// takes precedence over firmware/role detection. Otherwise grub2-efi is
+// picked when running under EFI and the disk has an EFI system partition,
+// falling back to syslinux/extlinux for legacy BIOS boot. systemd-boot is
+// only used when override names it.
+func Select(override string, efi bool, disk Disk) (Bootloader, error) {
+	strategy := override
+	if strategy == "" {
+		_, hasEFI := disk.ByRole(RoleEFI)
+		if efi && hasEFI {
+			strategy = StrategyGrub2EFI
+		} else {
+			strategy = StrategySyslinux
+		}
+	}
+
+	switch strategy {
+	case StrategyGrub2EFI:
+		return &Grub2EFI{}, nil
+	case StrategySystemdBoot:
+		return &SystemdBoot{}, nil
+	case StrategySyslinux:
+		return &Syslinux{}, nil
+	default:
+		return nil, fmt.Errorf("bootloader: unknown strategy: %s", strategy)
+	}
+}
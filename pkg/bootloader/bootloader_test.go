@@ -0,0 +1,53 @@
+package bootloader
+
+import "testing"
+
+func TestSelectOverrideTakesPrecedence(t *testing.T) {
+	bl, err := Select(StrategySyslinux, true, Disk{Partitions: []Partition{{Role: RoleEFI}}})
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if _, ok := bl.(*Syslinux); !ok {
+		t.Fatalf("expected override to win, got %T", bl)
+	}
+}
+
+func TestSelectPicksGrub2EFIWhenEFIBootedWithESP(t *testing.T) {
+	disk := Disk{Partitions: []Partition{{Role: RoleEFI}}}
+	bl, err := Select("", true, disk)
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if _, ok := bl.(*Grub2EFI); !ok {
+		t.Fatalf("expected grub2-efi, got %T", bl)
+	}
+}
+
+func TestSelectFallsBackToSyslinuxWithoutESP(t *testing.T) {
+	disk := Disk{Partitions: []Partition{{Role: RoleRoot}}}
+	bl, err := Select("", true, disk)
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if _, ok := bl.(*Syslinux); !ok {
+		t.Fatalf("expected syslinux fallback, got %T", bl)
+	}
+}
+
+func TestSelectFallsBackToSyslinuxWhenNotEFIBooted(t *testing.T) {
+	disk := Disk{Partitions: []Partition{{Role: RoleEFI}}}
+	bl, err := Select("", false, disk)
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if _, ok := bl.(*Syslinux); !ok {
+		t.Fatalf("expected syslinux when not booted via EFI, got %T", bl)
+	}
+}
+
+func TestSelectUnknownStrategyErrors(t *testing.T) {
+	_, err := Select("does-not-exist", true, Disk{})
+	if err == nil {
+		t.Fatal("expected an error for an unknown strategy")
+	}
+}
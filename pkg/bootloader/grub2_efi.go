@@ -0,0 +1,124 @@
+package bootloader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+
+	"git.f-i-ts.de/cloud-native/metal/metal-hammer/pkg"
+	log "github.com/inconshreveable/log15"
+)
+
+// Grub2EFI installs grub2 via shim for EFI systems and blesses the resulting
+// loader entry via efibootmgr. It only handles the x86_64 binary names
+// (shimx64.efi, grubx64.efi); arm64 binaries are not copied or registered.
+type Grub2EFI struct{}
+
+// Install implements Bootloader.
+func (g *Grub2EFI) Install(disk Disk, prefix string, kernelArgs []string) error {
+	efi, ok := disk.ByRole(RoleEFI)
+	if !ok {
+		return fmt.Errorf("bootloader: grub2-efi requires an efi partition")
+	}
+
+	info, err := readBootInfo(prefix)
+	if err != nil {
+		return err
+	}
+
+	esp := filepath.Join(prefix, efi.MountPoint)
+	dest := filepath.Join(esp, "EFI", "metal")
+	err = os.MkdirAll(dest, 0755)
+	if err != nil {
+		return fmt.Errorf("bootloader: create %s failed: %v", dest, err)
+	}
+
+	// copy shim/grub binaries as shipped in the rootfs's grub package
+	for _, binary := range []string{"shimx64.efi", "grubx64.efi"} {
+		src := filepath.Join(prefix, "boot", "efi", "EFI", "metal", binary)
+		err = copyFile(src, filepath.Join(dest, binary))
+		if err != nil {
+			return fmt.Errorf("bootloader: copy %s failed: %v", binary, err)
+		}
+	}
+
+	err = writeGrubConfig(dest, info, kernelArgs)
+	if err != nil {
+		return err
+	}
+
+	err = writeMBR(disk.Device)
+	if err != nil {
+		log.Warn("bootloader: writing protective mbr failed, continuing", "error", err)
+	}
+
+	out, err := exec.Command("efibootmgr", "--create", "--disk", disk.Device, "--part", fmt.Sprintf("%d", efi.Number),
+		"--loader", `\EFI\metal\shimx64.efi`, "--label", "metal").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("bootloader: efibootmgr failed: %v, output: %s", err, string(out))
+	}
+
+	return nil
+}
+
+// Probe implements Bootloader.
+func (g *Grub2EFI) Probe(disk Disk, prefix string) (bool, error) {
+	efi, ok := disk.ByRole(RoleEFI)
+	if !ok {
+		return false, nil
+	}
+	_, err := os.Stat(filepath.Join(prefix, efi.MountPoint, "EFI", "metal", "grubx64.efi"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeGrubConfig writes a minimal grub.cfg loader entry for the kernel and
+// initrd found in info, dest is the EFI/metal directory on the esp.
+func writeGrubConfig(dest string, info *pkg.Bootinfo, kernelArgs []string) error {
+	args := ""
+	for i, a := range kernelArgs {
+		if i > 0 {
+			args += " "
+		}
+		args += a
+	}
+
+	content := fmt.Sprintf(`set default=0
+set timeout=5
+
+menuentry "metal" {
+    linux %s %s
+    initrd %s
+}
+`, info.Kernel, args, info.Initrd)
+
+	return ioutil.WriteFile(filepath.Join(dest, "grub.cfg"), []byte(content), 0644)
+}
+
+func copyFile(src, dest string) error {
+	content, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dest, content, 0644)
+}
+
+func writeMBR(disk string) error {
+	mbr := "/usr/lib/grub/x86_64-efi/boot_hybrid.img"
+	if _, err := os.Stat(mbr); os.IsNotExist(err) {
+		mbr = path.Join("/usr", "lib", "grub", "i386-pc", "boot.img")
+	}
+	out, err := exec.Command("dd", "if="+mbr, "of="+disk, "bs=440", "count=1").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("dd of protective mbr failed: %v, output: %s", err, string(out))
+	}
+	return nil
+}
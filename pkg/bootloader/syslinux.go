@@ -0,0 +1,85 @@
+package bootloader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Syslinux installs extlinux plus a legacy MBR for BIOS boot, used as a
+// fallback on disks without an EFI system partition.
+type Syslinux struct{}
+
+// Install implements Bootloader.
+func (s *Syslinux) Install(disk Disk, prefix string, kernelArgs []string) error {
+	boot, ok := disk.ByRole(RoleBoot)
+	if !ok {
+		boot, ok = disk.ByRole(RoleRoot)
+	}
+	if !ok {
+		return fmt.Errorf("bootloader: syslinux requires a boot or root partition")
+	}
+
+	info, err := readBootInfo(prefix)
+	if err != nil {
+		return err
+	}
+
+	bootDir := filepath.Join(prefix, boot.MountPoint, "extlinux")
+	err = os.MkdirAll(bootDir, 0755)
+	if err != nil {
+		return fmt.Errorf("bootloader: create %s failed: %v", bootDir, err)
+	}
+
+	args := ""
+	for i, a := range kernelArgs {
+		if i > 0 {
+			args += " "
+		}
+		args += a
+	}
+
+	conf := fmt.Sprintf(`default metal
+label metal
+  kernel %s
+  append initrd=%s %s
+`, info.Kernel, info.Initrd, args)
+
+	err = ioutil.WriteFile(filepath.Join(bootDir, "extlinux.conf"), []byte(conf), 0644)
+	if err != nil {
+		return fmt.Errorf("bootloader: write extlinux.conf failed: %v", err)
+	}
+
+	out, err := exec.Command("extlinux", "--install", bootDir).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("bootloader: extlinux --install failed: %v, output: %s", err, string(out))
+	}
+
+	out, err = exec.Command("dd", "bs=440", "count=1", "if=/usr/share/syslinux/gptmbr.bin", "of="+disk.Device).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("bootloader: writing gptmbr.bin failed: %v, output: %s", err, string(out))
+	}
+
+	return nil
+}
+
+// Probe implements Bootloader.
+func (s *Syslinux) Probe(disk Disk, prefix string) (bool, error) {
+	boot, ok := disk.ByRole(RoleBoot)
+	if !ok {
+		boot, ok = disk.ByRole(RoleRoot)
+	}
+	if !ok {
+		return false, nil
+	}
+	_, err := os.Stat(filepath.Join(prefix, boot.MountPoint, "extlinux", "extlinux.conf"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
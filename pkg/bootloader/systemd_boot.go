@@ -0,0 +1,89 @@
+package bootloader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// SystemdBoot installs systemd-boot onto the EFI system partition.
+type SystemdBoot struct{}
+
+// Install implements Bootloader.
+func (s *SystemdBoot) Install(disk Disk, prefix string, kernelArgs []string) error {
+	efi, ok := disk.ByRole(RoleEFI)
+	if !ok {
+		return fmt.Errorf("bootloader: systemd-boot requires an efi partition")
+	}
+
+	info, err := readBootInfo(prefix)
+	if err != nil {
+		return err
+	}
+
+	esp := filepath.Join(prefix, efi.MountPoint)
+	bootBin := filepath.Join(esp, "EFI", "systemd", "systemd-bootx64.efi")
+	err = os.MkdirAll(filepath.Dir(bootBin), 0755)
+	if err != nil {
+		return fmt.Errorf("bootloader: create %s failed: %v", filepath.Dir(bootBin), err)
+	}
+	src := filepath.Join(prefix, "usr", "lib", "systemd", "boot", "efi", "systemd-bootx64.efi")
+	err = copyFile(src, bootBin)
+	if err != nil {
+		return fmt.Errorf("bootloader: copy systemd-boot binary failed: %v", err)
+	}
+	bootFallback := filepath.Join(esp, "EFI", "BOOT", "BOOTX64.EFI")
+	err = os.MkdirAll(filepath.Dir(bootFallback), 0755)
+	if err != nil {
+		return fmt.Errorf("bootloader: create %s failed: %v", filepath.Dir(bootFallback), err)
+	}
+	err = copyFile(src, bootFallback)
+	if err != nil {
+		return fmt.Errorf("bootloader: copy fallback systemd-boot binary failed: %v", err)
+	}
+
+	entriesDir := filepath.Join(esp, "loader", "entries")
+	err = os.MkdirAll(entriesDir, 0755)
+	if err != nil {
+		return fmt.Errorf("bootloader: create %s failed: %v", entriesDir, err)
+	}
+
+	args := ""
+	for i, a := range kernelArgs {
+		if i > 0 {
+			args += " "
+		}
+		args += a
+	}
+
+	entry := fmt.Sprintf(`title metal
+linux %s
+initrd %s
+options %s
+`, info.Kernel, info.Initrd, args)
+
+	err = ioutil.WriteFile(filepath.Join(entriesDir, "metal.conf"), []byte(entry), 0644)
+	if err != nil {
+		return fmt.Errorf("bootloader: write loader entry failed: %v", err)
+	}
+
+	loaderConf := "default metal\ntimeout 5\n"
+	return ioutil.WriteFile(filepath.Join(esp, "loader", "loader.conf"), []byte(loaderConf), 0644)
+}
+
+// Probe implements Bootloader.
+func (s *SystemdBoot) Probe(disk Disk, prefix string) (bool, error) {
+	efi, ok := disk.ByRole(RoleEFI)
+	if !ok {
+		return false, nil
+	}
+	_, err := os.Stat(filepath.Join(prefix, efi.MountPoint, "EFI", "systemd", "systemd-bootx64.efi"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,41 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// CheckSHA256 compares the sha256 of the file at path against a
+// "<hexdigest>  <filename>" style sums file at sumsPath, the format used by
+// sha256sum. It replaces the previous md5-based integrity check.
+func CheckSHA256(path, sumsPath string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("image: open %s for checksum failed: %v", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return false, fmt.Errorf("image: hash %s failed: %v", path, err)
+	}
+	actual := hex.EncodeToString(h.Sum(nil))
+
+	sums, err := ioutil.ReadFile(sumsPath)
+	if err != nil {
+		return false, fmt.Errorf("image: read %s failed: %v", sumsPath, err)
+	}
+
+	fields := strings.Fields(string(sums))
+	if len(fields) == 0 {
+		return false, fmt.Errorf("image: %s is empty", sumsPath)
+	}
+
+	return fields[0] == actual, nil
+}
@@ -0,0 +1,96 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	zstd "github.com/klauspost/compress/zstd"
+	lz4 "github.com/pierrec/lz4"
+	"github.com/ulikunitz/xz"
+)
+
+// Decompressor wraps a still compressed stream with the matching decompression reader.
+type Decompressor interface {
+	Decompress(r io.Reader) (io.Reader, error)
+}
+
+var magicBytes = map[string][]byte{
+	".lz4": {0x04, 0x22, 0x4d, 0x18},
+	".zst": {0x28, 0xb5, 0x2f, 0xfd},
+	".xz":  {0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00},
+	".gz":  {0x1f, 0x8b},
+}
+
+// ResolveDecompressor picks a Decompressor for name based on its filename
+// suffix, falling back to sniffing the magic bytes of the stream itself
+// when the suffix is unknown or missing. It returns a reader positioned at
+// the start of the (still compressed) stream, since sniffing may consume
+// a few bytes from r.
+func ResolveDecompressor(name string, r io.Reader) (Decompressor, io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	for suffix, d := range decompressors {
+		if strings.HasSuffix(name, suffix) {
+			return d, br, nil
+		}
+	}
+
+	head, err := br.Peek(6)
+	if err != nil && err != io.EOF {
+		return nil, br, fmt.Errorf("image: unable to sniff compression format: %v", err)
+	}
+	for suffix, magic := range magicBytes {
+		if bytes.HasPrefix(head, magic) {
+			return decompressors[suffix], br, nil
+		}
+	}
+
+	return nil, br, fmt.Errorf("image: unsupported or unrecognized compression format for: %s", name)
+}
+
+var decompressors = map[string]Decompressor{
+	".lz4": lz4Decompressor{},
+	".zst": zstdDecompressor{},
+	".xz":  xzDecompressor{},
+	".gz":  gzipDecompressor{},
+}
+
+type lz4Decompressor struct{}
+
+func (lz4Decompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return lz4.NewReader(r), nil
+}
+
+type zstdDecompressor struct{}
+
+func (zstdDecompressor) Decompress(r io.Reader) (io.Reader, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("image: create zstd reader failed: %v", err)
+	}
+	return d.IOReadCloser(), nil
+}
+
+type xzDecompressor struct{}
+
+func (xzDecompressor) Decompress(r io.Reader) (io.Reader, error) {
+	xr, err := xz.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("image: create xz reader failed: %v", err)
+	}
+	return xr, nil
+}
+
+type gzipDecompressor struct{}
+
+func (gzipDecompressor) Decompress(r io.Reader) (io.Reader, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("image: create gzip reader failed: %v", err)
+	}
+	return gr, nil
+}
@@ -0,0 +1,43 @@
+package image
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestResolveDecompressorBySuffix(t *testing.T) {
+	d, _, err := ResolveDecompressor("os-image.tar.gz", bytes.NewReader(nil))
+	if err != nil {
+		t.Fatalf("ResolveDecompressor failed: %v", err)
+	}
+	if _, ok := d.(gzipDecompressor); !ok {
+		t.Fatalf("expected gzipDecompressor for .gz suffix, got %T", d)
+	}
+}
+
+func TestResolveDecompressorByMagicBytes(t *testing.T) {
+	zst := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x00}
+	d, r, err := ResolveDecompressor("os-image", bytes.NewReader(zst))
+	if err != nil {
+		t.Fatalf("ResolveDecompressor failed: %v", err)
+	}
+	if _, ok := d.(zstdDecompressor); !ok {
+		t.Fatalf("expected zstdDecompressor from magic bytes, got %T", d)
+	}
+
+	// the returned reader must still carry the sniffed bytes
+	head := make([]byte, 4)
+	if _, err := r.Read(head); err != nil {
+		t.Fatalf("read from returned reader failed: %v", err)
+	}
+	if !bytes.Equal(head, zst[:4]) {
+		t.Fatalf("expected sniffed bytes to still be readable, got %v", head)
+	}
+}
+
+func TestResolveDecompressorUnsupportedFormat(t *testing.T) {
+	_, _, err := ResolveDecompressor("os-image", bytes.NewReader([]byte{0x00, 0x01, 0x02, 0x03}))
+	if err == nil {
+		t.Fatal("expected an error for an unrecognized format")
+	}
+}
@@ -0,0 +1,45 @@
+package image
+
+import (
+	"io"
+
+	pb "gopkg.in/cheggaaa/pb.v1"
+)
+
+// Progress wraps a byte counter so the same download/extraction progress can
+// drive both the terminal progress bar and, eventually, structured progress
+// events reported to metal-core.
+type Progress interface {
+	// NewProxyReader wraps r so every read increments the counter.
+	NewProxyReader(r io.Reader) io.Reader
+	Start()
+	Finish()
+}
+
+// TerminalProgress renders progress as a terminal bar, same look and feel as before.
+type TerminalProgress struct {
+	bar *pb.ProgressBar
+}
+
+// NewTerminalProgress creates a Progress that drives a terminal bar sized to total bytes.
+func NewTerminalProgress(total int64) *TerminalProgress {
+	bar := pb.New64(total).SetUnits(pb.U_BYTES)
+	bar.SetWidth(80)
+	bar.ShowSpeed = true
+	return &TerminalProgress{bar: bar}
+}
+
+// NewProxyReader implements Progress.
+func (t *TerminalProgress) NewProxyReader(r io.Reader) io.Reader {
+	return t.bar.NewProxyReader(r)
+}
+
+// Start implements Progress.
+func (t *TerminalProgress) Start() {
+	t.bar.Start()
+}
+
+// Finish implements Progress.
+func (t *TerminalProgress) Finish() {
+	t.bar.Finish()
+}
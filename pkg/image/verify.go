@@ -0,0 +1,138 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// Verifier checks that data's signature, fetched from sigURL, is valid.
+type Verifier interface {
+	Verify(data io.Reader, sigURL string) error
+}
+
+// GPGVerifier checks a detached GPG signature against a set of pinned
+// public keys. data must be fully re-readable, callers are expected to pass
+// a source that was first spooled to disk, see pull() in cmd/install.go.
+type GPGVerifier struct {
+	// PubKeys is a list of armored GPG public keys, pinned via Specification.ImagePubKeys.
+	PubKeys []string
+}
+
+// Verify implements Verifier.
+func (v *GPGVerifier) Verify(data io.Reader, sigURL string) error {
+	keyring, err := v.loadKeyring()
+	if err != nil {
+		return err
+	}
+
+	sig, err := fetch(sigURL)
+	if err != nil {
+		return fmt.Errorf("image: fetch gpg signature %s failed: %v", sigURL, err)
+	}
+
+	_, err = openpgp.CheckDetachedSignature(keyring, data, bytes.NewReader(sig))
+	if err != nil {
+		return fmt.Errorf("image: gpg signature verification failed: %v", err)
+	}
+	return nil
+}
+
+func (v *GPGVerifier) loadKeyring() (openpgp.EntityList, error) {
+	var keyring openpgp.EntityList
+	for _, k := range v.PubKeys {
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader([]byte(k)))
+		if err != nil {
+			return nil, fmt.Errorf("image: parse pinned gpg pubkey failed: %v", err)
+		}
+		keyring = append(keyring, entities...)
+	}
+	if len(keyring) == 0 {
+		return nil, fmt.Errorf("image: no gpg pubkeys pinned")
+	}
+	return keyring, nil
+}
+
+// CosignVerifier checks a cosign/sigstore bundle by shelling out to the
+// cosign binary, mirroring how install.sh is invoked out-of-process.
+type CosignVerifier struct {
+	// PubKeys is a list of PEM-encoded cosign public keys.
+	PubKeys []string
+}
+
+// Verify implements Verifier. data is spooled to a temporary file because
+// cosign verify-blob operates on a path, not a stream.
+func (v *CosignVerifier) Verify(data io.Reader, sigURL string) error {
+	tmp, err := ioutil.TempFile("", "cosign-blob")
+	if err != nil {
+		return fmt.Errorf("image: create temp file for cosign verification failed: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	_, err = io.Copy(tmp, data)
+	if err != nil {
+		return fmt.Errorf("image: spool image for cosign verification failed: %v", err)
+	}
+
+	bundle, err := fetch(sigURL)
+	if err != nil {
+		return fmt.Errorf("image: fetch cosign bundle %s failed: %v", sigURL, err)
+	}
+	bundleFile, err := ioutil.TempFile("", "cosign-bundle")
+	if err != nil {
+		return fmt.Errorf("image: create temp file for cosign bundle failed: %v", err)
+	}
+	defer os.Remove(bundleFile.Name())
+	defer bundleFile.Close()
+	_, err = bundleFile.Write(bundle)
+	if err != nil {
+		return fmt.Errorf("image: write cosign bundle failed: %v", err)
+	}
+
+	var lastErr error
+	for _, k := range v.PubKeys {
+		keyFile, err := ioutil.TempFile("", "cosign-key")
+		if err != nil {
+			return fmt.Errorf("image: create temp file for cosign pubkey failed: %v", err)
+		}
+		_, err = keyFile.WriteString(k)
+		keyFile.Close()
+		if err != nil {
+			os.Remove(keyFile.Name())
+			return fmt.Errorf("image: write cosign pubkey failed: %v", err)
+		}
+
+		out, err := exec.Command("cosign", "verify-blob", "--key", keyFile.Name(), "--bundle", bundleFile.Name(), tmp.Name()).CombinedOutput()
+		os.Remove(keyFile.Name())
+		if err == nil {
+			return nil
+		}
+		lastErr = fmt.Errorf("cosign verify-blob failed: %v, output: %s", err, string(out))
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("image: no cosign pubkeys pinned")
+	}
+	return lastErr
+}
+
+// fetch retrieves url through the same pluggable ImageSource used for the
+// image payload itself, so a signature/bundle served alongside an s3:// or
+// file:// image is reachable too, not just http(s)://.
+func fetch(url string) ([]byte, error) {
+	source, err := ResolveSource(url)
+	if err != nil {
+		return nil, err
+	}
+	r, err := source.Open(url)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,249 @@
+package provision
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// Apply applies c to the rootfs rooted at prefix. It runs before the
+// optional install.sh of the target OS and is safe to run more than once:
+// every stage is idempotent, re-applying the same Config converges to the
+// same tree instead of appending or duplicating state.
+func (c *Config) Apply(prefix string) error {
+	err := c.Validate()
+	if err != nil {
+		return fmt.Errorf("provision: invalid config: %v", err)
+	}
+
+	err = c.applyDirectories(prefix)
+	if err != nil {
+		return err
+	}
+	err = c.applyFiles(prefix)
+	if err != nil {
+		return err
+	}
+	err = c.applySystemdUnits(prefix)
+	if err != nil {
+		return err
+	}
+	err = c.applyUsers(prefix)
+	if err != nil {
+		return err
+	}
+	err = c.applyNetworkd(prefix)
+	if err != nil {
+		return err
+	}
+	err = c.applyKernelArguments(prefix)
+	if err != nil {
+		return err
+	}
+	err = c.applyBootloaderPatch(prefix)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Config) applyDirectories(prefix string) error {
+	for _, d := range c.Directories {
+		dest := filepath.Join(prefix, d.Path)
+		mode := os.FileMode(d.Mode)
+		if mode == 0 {
+			mode = 0755
+		}
+		log.Info("provision directory", "path", dest)
+		err := os.MkdirAll(dest, mode)
+		if err != nil {
+			return fmt.Errorf("provision: create directory %s failed: %v", dest, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) applyFiles(prefix string) error {
+	for _, f := range c.Files {
+		dest := filepath.Join(prefix, f.Path)
+		log.Info("provision file", "path", dest)
+
+		content, err := fetchFileContents(f)
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(filepath.Dir(dest), 0755)
+		if err != nil {
+			return fmt.Errorf("provision: create parent directory of %s failed: %v", dest, err)
+		}
+
+		mode := os.FileMode(f.Mode)
+		if mode == 0 {
+			mode = 0644
+		}
+		err = ioutil.WriteFile(dest, content, mode)
+		if err != nil {
+			return fmt.Errorf("provision: write file %s failed: %v", dest, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) applySystemdUnits(prefix string) error {
+	for _, u := range c.Systemd.Units {
+		unitDir := filepath.Join(prefix, "etc", "systemd", "system")
+		wantsDir := filepath.Join(unitDir, "multi-user.target.wants")
+
+		if u.Mask {
+			log.Info("provision systemd mask", "unit", u.Name)
+			err := os.Symlink("/dev/null", filepath.Join(unitDir, u.Name))
+			if err != nil && !os.IsExist(err) {
+				return fmt.Errorf("provision: mask unit %s failed: %v", u.Name, err)
+			}
+			continue
+		}
+
+		if u.Enabled {
+			log.Info("provision systemd enable", "unit", u.Name)
+			err := os.MkdirAll(wantsDir, 0755)
+			if err != nil {
+				return fmt.Errorf("provision: create %s failed: %v", wantsDir, err)
+			}
+			link := filepath.Join(wantsDir, u.Name)
+			err = os.Remove(link)
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("provision: remove stale symlink %s failed: %v", link, err)
+			}
+			err = os.Symlink(filepath.Join("..", u.Name), link)
+			if err != nil {
+				return fmt.Errorf("provision: enable unit %s failed: %v", u.Name, err)
+			}
+		}
+
+		for _, di := range u.Dropins {
+			dropinDir := filepath.Join(unitDir, u.Name+".d")
+			err := os.MkdirAll(dropinDir, 0755)
+			if err != nil {
+				return fmt.Errorf("provision: create dropin directory %s failed: %v", dropinDir, err)
+			}
+			dest := filepath.Join(dropinDir, di.Name)
+			err = ioutil.WriteFile(dest, []byte(di.Contents), 0644)
+			if err != nil {
+				return fmt.Errorf("provision: write dropin %s failed: %v", dest, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) applyUsers(prefix string) error {
+	for _, u := range c.Users {
+		log.Info("provision user", "name", u.Name)
+
+		args := []string{"--root", prefix, "--create-home"}
+		if u.UID != nil {
+			args = append(args, "--uid", fmt.Sprintf("%d", *u.UID))
+		}
+		if len(u.Groups) > 0 {
+			args = append(args, "--groups", joinComma(u.Groups))
+		}
+		if u.PasswordHash != "" {
+			args = append(args, "--password", u.PasswordHash)
+		}
+		args = append(args, u.Name)
+
+		err := runUseradd(prefix, u.Name, args)
+		if err != nil {
+			return fmt.Errorf("provision: create user %s failed: %v", u.Name, err)
+		}
+
+		if len(u.SSHAuthorizedKeys) > 0 {
+			err = writeAuthorizedKeys(prefix, u.Name, u.SSHAuthorizedKeys)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) applyNetworkd(prefix string) error {
+	if len(c.Networkd) == 0 {
+		return nil
+	}
+	dir := filepath.Join(prefix, "etc", "systemd", "network")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("provision: create networkd directory %s failed: %v", dir, err)
+	}
+	for _, n := range c.Networkd {
+		dest := filepath.Join(dir, n.Name)
+		log.Info("provision networkd", "path", dest)
+		err := ioutil.WriteFile(dest, []byte(n.Contents), 0644)
+		if err != nil {
+			return fmt.Errorf("provision: write networkd unit %s failed: %v", dest, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) applyKernelArguments(prefix string) error {
+	if len(c.KernelArguments) == 0 {
+		return nil
+	}
+	configdir := filepath.Join(prefix, "etc", "metal")
+	err := os.MkdirAll(configdir, 0755)
+	if err != nil {
+		return fmt.Errorf("provision: create %s failed: %v", configdir, err)
+	}
+	dest := filepath.Join(configdir, "kernel-arguments")
+	content := ""
+	for i, a := range c.KernelArguments {
+		if i > 0 {
+			content += " "
+		}
+		content += a
+	}
+	log.Info("provision kernel arguments", "path", dest, "arguments", c.KernelArguments)
+	return ioutil.WriteFile(dest, []byte(content), 0644)
+}
+
+// applyBootloaderPatch replaces everything between BeginMarker and EndMarker
+// in Path with Replacement, keeping both markers in place. Re-applying the same patch is a
+// no-op once Path already matches the desired contents.
+func (c *Config) applyBootloaderPatch(prefix string) error {
+	p := c.BootloaderPatch
+	if p == nil {
+		return nil
+	}
+	dest := filepath.Join(prefix, p.Path)
+	log.Info("provision bootloader patch", "path", dest)
+
+	content, err := ioutil.ReadFile(dest)
+	if err != nil {
+		return fmt.Errorf("provision: read bootloader config %s failed: %v", dest, err)
+	}
+
+	pattern := regexp.MustCompile(regexp.QuoteMeta(p.BeginMarker) + `(?s).*?` + regexp.QuoteMeta(p.EndMarker))
+	replacement := p.BeginMarker + p.Replacement + p.EndMarker
+	patched := pattern.ReplaceAll(content, []byte(replacement))
+
+	return ioutil.WriteFile(dest, patched, 0644)
+}
+
+func joinComma(parts []string) string {
+	out := ""
+	for i, p := range parts {
+		if i > 0 {
+			out += ","
+		}
+		out += p
+	}
+	return out
+}
@@ -0,0 +1,176 @@
+package provision
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyFilesAndDirectories(t *testing.T) {
+	prefix, err := ioutil.TempDir("", "provision-apply")
+	if err != nil {
+		t.Fatalf("create tempdir failed: %v", err)
+	}
+	defer os.RemoveAll(prefix)
+
+	c := &Config{
+		Directories: []Directory{
+			{Path: "/etc/myapp", Mode: 0755},
+		},
+		Files: []File{
+			{Path: "/etc/myapp/config.yaml", Mode: 0644, Contents: "key: value\n"},
+		},
+		KernelArguments: []string{"console=ttyS0,115200n8", "quiet"},
+	}
+
+	err = c.Apply(prefix)
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(prefix, "etc", "myapp", "config.yaml"))
+	if err != nil {
+		t.Fatalf("expected config.yaml to be written: %v", err)
+	}
+	if string(got) != "key: value\n" {
+		t.Fatalf("unexpected config.yaml contents: %q", string(got))
+	}
+
+	kargs, err := ioutil.ReadFile(filepath.Join(prefix, "etc", "metal", "kernel-arguments"))
+	if err != nil {
+		t.Fatalf("expected kernel-arguments to be written: %v", err)
+	}
+	if string(kargs) != "console=ttyS0,115200n8 quiet" {
+		t.Fatalf("unexpected kernel-arguments contents: %q", string(kargs))
+	}
+
+	// applying the same config again must converge to the same state, not fail or duplicate
+	err = c.Apply(prefix)
+	if err != nil {
+		t.Fatalf("second apply failed: %v", err)
+	}
+}
+
+func TestUserExists(t *testing.T) {
+	prefix, err := ioutil.TempDir("", "provision-users")
+	if err != nil {
+		t.Fatalf("create tempdir failed: %v", err)
+	}
+	defer os.RemoveAll(prefix)
+
+	exists, err := userExists(prefix, "metal")
+	if err != nil {
+		t.Fatalf("userExists on a rootfs without /etc/passwd failed: %v", err)
+	}
+	if exists {
+		t.Fatal("expected no user to exist before /etc/passwd is written")
+	}
+
+	err = os.MkdirAll(filepath.Join(prefix, "etc"), 0755)
+	if err != nil {
+		t.Fatalf("create etc dir failed: %v", err)
+	}
+	passwd := "root:x:0:0:root:/root:/bin/bash\nmetal:x:1000:1000::/home/metal:/bin/bash\n"
+	err = ioutil.WriteFile(filepath.Join(prefix, "etc", "passwd"), []byte(passwd), 0644)
+	if err != nil {
+		t.Fatalf("write passwd failed: %v", err)
+	}
+
+	exists, err = userExists(prefix, "metal")
+	if err != nil {
+		t.Fatalf("userExists failed: %v", err)
+	}
+	if !exists {
+		t.Fatal("expected metal to be found in /etc/passwd")
+	}
+
+	exists, err = userExists(prefix, "nobody")
+	if err != nil {
+		t.Fatalf("userExists failed: %v", err)
+	}
+	if exists {
+		t.Fatal("expected nobody to not be found in /etc/passwd")
+	}
+}
+
+func TestRunUseraddSkipsExistingUser(t *testing.T) {
+	prefix, err := ioutil.TempDir("", "provision-users")
+	if err != nil {
+		t.Fatalf("create tempdir failed: %v", err)
+	}
+	defer os.RemoveAll(prefix)
+
+	err = os.MkdirAll(filepath.Join(prefix, "etc"), 0755)
+	if err != nil {
+		t.Fatalf("create etc dir failed: %v", err)
+	}
+	passwd := "metal:x:1000:1000::/home/metal:/bin/bash\n"
+	err = ioutil.WriteFile(filepath.Join(prefix, "etc", "passwd"), []byte(passwd), 0644)
+	if err != nil {
+		t.Fatalf("write passwd failed: %v", err)
+	}
+
+	// an already-present user must short-circuit before useradd is ever
+	// exec'd, so this must succeed even with a nonsense argv that would
+	// make a real useradd invocation fail.
+	err = runUseradd(prefix, "metal", []string{"--this-flag-does-not-exist"})
+	if err != nil {
+		t.Fatalf("expected runUseradd to skip an already-existing user, got: %v", err)
+	}
+}
+
+func TestApplyBootloaderPatchIsIdempotent(t *testing.T) {
+	prefix, err := ioutil.TempDir("", "provision-grub")
+	if err != nil {
+		t.Fatalf("create tempdir failed: %v", err)
+	}
+	defer os.RemoveAll(prefix)
+
+	grubPath := "/boot/grub/grub.cfg"
+	dest := filepath.Join(prefix, grubPath)
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		t.Fatalf("create grub dir failed: %v", err)
+	}
+	original := "set default=0\n# BEGIN CONSOLE\nconsole=tty0\n# END CONSOLE\nset timeout=5\n"
+	err = ioutil.WriteFile(dest, []byte(original), 0644)
+	if err != nil {
+		t.Fatalf("write grub.cfg failed: %v", err)
+	}
+
+	c := &Config{
+		BootloaderPatch: &BootloaderPatch{
+			Path:        grubPath,
+			BeginMarker: "# BEGIN CONSOLE",
+			EndMarker:   "# END CONSOLE",
+			Replacement: "\nconsole=ttyS1,115200n8\n",
+		},
+	}
+
+	err = c.Apply(prefix)
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	patched, err := ioutil.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("read patched grub.cfg failed: %v", err)
+	}
+	want := "set default=0\n# BEGIN CONSOLE\nconsole=ttyS1,115200n8\n# END CONSOLE\nset timeout=5\n"
+	if string(patched) != want {
+		t.Fatalf("unexpected grub.cfg contents:\ngot:  %q\nwant: %q", string(patched), want)
+	}
+
+	err = c.Apply(prefix)
+	if err != nil {
+		t.Fatalf("second apply failed: %v", err)
+	}
+	reapplied, err := ioutil.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("read re-patched grub.cfg failed: %v", err)
+	}
+	if string(reapplied) != want {
+		t.Fatalf("patch is not idempotent:\ngot:  %q\nwant: %q", string(reapplied), want)
+	}
+}
@@ -0,0 +1,83 @@
+// Package provision implements an Ignition-inspired, declarative post-install
+// provisioning step. Config is delivered by metal-core alongside the device
+// response and is applied to the extracted rootfs before the optional
+// install.sh of the target OS is run.
+package provision
+
+// Config is the declarative set of changes applied to a freshly extracted
+// rootfs by Apply.
+type Config struct {
+	Files           []File           `json:"files,omitempty"`
+	Directories     []Directory      `json:"directories,omitempty"`
+	Systemd         Systemd          `json:"systemd,omitempty"`
+	Users           []User           `json:"users,omitempty"`
+	Networkd        []NetworkdUnit   `json:"networkd,omitempty"`
+	KernelArguments []string         `json:"kernelArguments,omitempty"`
+	BootloaderPatch *BootloaderPatch `json:"bootloaderPatch,omitempty"`
+}
+
+// File describes a single file to place into the rootfs, either with
+// inline content or fetched from URL and verified against SHA256.
+type File struct {
+	Path     string `json:"path"`
+	Mode     uint32 `json:"mode"`
+	Owner    string `json:"owner,omitempty"`
+	Group    string `json:"group,omitempty"`
+	Contents string `json:"contents,omitempty"`
+	URL      string `json:"url,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+}
+
+// Directory describes a directory to create in the rootfs.
+type Directory struct {
+	Path  string `json:"path"`
+	Mode  uint32 `json:"mode"`
+	Owner string `json:"owner,omitempty"`
+	Group string `json:"group,omitempty"`
+}
+
+// Systemd groups the systemd units to enable, mask or drop-in configure.
+type Systemd struct {
+	Units []SystemdUnit `json:"units,omitempty"`
+}
+
+// SystemdUnit describes the desired state of a single systemd unit.
+type SystemdUnit struct {
+	Name    string   `json:"name"`
+	Enabled bool     `json:"enabled"`
+	Mask    bool     `json:"mask"`
+	Dropins []Dropin `json:"dropins,omitempty"`
+}
+
+// Dropin is a systemd unit drop-in snippet.
+type Dropin struct {
+	Name     string `json:"name"`
+	Contents string `json:"contents"`
+}
+
+// User describes a local user account to create. An account that already
+// exists is left as it is, only its authorized_keys file is rewritten.
+type User struct {
+	Name              string   `json:"name"`
+	UID               *int     `json:"uid,omitempty"`
+	Groups            []string `json:"groups,omitempty"`
+	PasswordHash      string   `json:"passwordHash,omitempty"`
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+}
+
+// NetworkdUnit is a systemd-networkd configuration snippet, written as-is
+// into /etc/systemd/network/<name>.
+type NetworkdUnit struct {
+	Name     string `json:"name"`
+	Contents string `json:"contents"`
+}
+
+// BootloaderPatch replaces a regex-delimited block in a bootloader config
+// file, e.g. a console-settings marker in grub.cfg, so operators can inject
+// parameters without shipping a full bootloader template.
+type BootloaderPatch struct {
+	Path        string `json:"path"`
+	BeginMarker string `json:"beginMarker"`
+	EndMarker   string `json:"endMarker"`
+	Replacement string `json:"replacement"`
+}
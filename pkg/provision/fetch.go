@@ -0,0 +1,41 @@
+package provision
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// fetchFileContents returns the contents of f, either inline or downloaded
+// from f.URL, verifying the SHA256 checksum when f.SHA256 is set.
+func fetchFileContents(f File) ([]byte, error) {
+	if f.URL == "" {
+		return []byte(f.Contents), nil
+	}
+
+	resp, err := http.Get(f.URL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch file %s from %s failed: %v", f.Path, f.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch file %s from %s failed with status: %s", f.Path, f.URL, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("fetch file %s from %s, reading body failed: %v", f.Path, f.URL, err)
+	}
+
+	if f.SHA256 != "" {
+		sum := sha256.Sum256(body)
+		if hex.EncodeToString(sum[:]) != f.SHA256 {
+			return nil, fmt.Errorf("fetch file %s from %s, sha256 mismatch", f.Path, f.URL)
+		}
+	}
+
+	return body, nil
+}
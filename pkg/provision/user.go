@@ -0,0 +1,74 @@
+package provision
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runUseradd shells out to the host's useradd so user/group bookkeeping
+// (e.g. /etc/passwd, /etc/shadow, /etc/group) stays consistent, operating
+// on the rootfs via its --root flag instead of a chroot. It is a no-op if
+// name already has an entry in prefix's /etc/passwd, so callers can apply
+// the same Config more than once without useradd failing on an existing
+// account.
+func runUseradd(prefix, name string, args []string) error {
+	exists, err := userExists(prefix, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	out, err := exec.Command("useradd", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("useradd %v failed: %v, output: %s", args, err, string(out))
+	}
+	return nil
+}
+
+// userExists reports whether name already has an /etc/passwd entry under
+// prefix, treating a missing passwd file as "no users yet" rather than an error.
+func userExists(prefix, name string) (bool, error) {
+	f, err := os.Open(filepath.Join(prefix, "etc", "passwd"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("provision: read %s/etc/passwd failed: %v", prefix, err)
+	}
+	defer f.Close()
+
+	prefixField := name + ":"
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), prefixField) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// writeAuthorizedKeys writes keys to ~user/.ssh/authorized_keys inside prefix.
+func writeAuthorizedKeys(prefix, user string, keys []string) error {
+	sshDir := filepath.Join(prefix, "home", user, ".ssh")
+	if user == "root" {
+		sshDir = filepath.Join(prefix, "root", ".ssh")
+	}
+	err := os.MkdirAll(sshDir, 0700)
+	if err != nil {
+		return fmt.Errorf("provision: create %s failed: %v", sshDir, err)
+	}
+
+	content := ""
+	for _, k := range keys {
+		content += k + "\n"
+	}
+	dest := filepath.Join(sshDir, "authorized_keys")
+	return ioutil.WriteFile(dest, []byte(content), 0600)
+}
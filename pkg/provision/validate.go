@@ -0,0 +1,54 @@
+package provision
+
+import "fmt"
+
+// Validate checks c for structural errors before Apply is attempted.
+func (c *Config) Validate() error {
+	for _, f := range c.Files {
+		if f.Path == "" {
+			return fmt.Errorf("provision: file entry without path")
+		}
+		if f.URL != "" && f.Contents != "" {
+			return fmt.Errorf("provision: file %s sets both url and inline contents", f.Path)
+		}
+		if f.URL != "" && f.SHA256 == "" {
+			return fmt.Errorf("provision: file %s fetched from url but has no sha256", f.Path)
+		}
+	}
+
+	for _, d := range c.Directories {
+		if d.Path == "" {
+			return fmt.Errorf("provision: directory entry without path")
+		}
+	}
+
+	for _, u := range c.Systemd.Units {
+		if u.Name == "" {
+			return fmt.Errorf("provision: systemd unit entry without name")
+		}
+		if u.Enabled && u.Mask {
+			return fmt.Errorf("provision: systemd unit %s is both enabled and masked", u.Name)
+		}
+	}
+
+	for _, u := range c.Users {
+		if u.Name == "" {
+			return fmt.Errorf("provision: user entry without name")
+		}
+	}
+
+	for _, n := range c.Networkd {
+		if n.Name == "" {
+			return fmt.Errorf("provision: networkd entry without name")
+		}
+	}
+
+	if c.BootloaderPatch != nil {
+		p := c.BootloaderPatch
+		if p.Path == "" || p.BeginMarker == "" || p.EndMarker == "" {
+			return fmt.Errorf("provision: bootloaderPatch requires path, beginMarker and endMarker")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+const (
+	batchSize     = 20
+	batchInterval = 2 * time.Second
+	queueCapacity = 1000
+	minBackoff    = 1 * time.Second
+	maxBackoff    = 30 * time.Second
+)
+
+// Client batches Events and posts them to metal-core, keyed by deviceUUID.
+// Sending never blocks the install: once the internal queue is full, the
+// oldest queued event is dropped to make room for the newest one.
+type Client struct {
+	url        string
+	httpClient *http.Client
+	queue      chan Event
+	stop       chan struct{}
+}
+
+// NewClient creates a Client reporting to baseURL for deviceUUID. Call
+// Start to begin delivering events in the background.
+func NewClient(baseURL, deviceUUID string) *Client {
+	return &Client{
+		url:        fmt.Sprintf("%s/device/%s/events", baseURL, deviceUUID),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		queue:      make(chan Event, queueCapacity),
+		stop:       make(chan struct{}),
+	}
+}
+
+// Start begins batching and delivering events in the background.
+func (c *Client) Start() {
+	go c.run()
+}
+
+// Stop ends delivery, already queued events are dropped.
+func (c *Client) Stop() {
+	close(c.stop)
+}
+
+// send enqueues e without blocking, dropping the oldest queued event if full.
+func (c *Client) send(e Event) {
+	e.Timestamp = time.Now().Unix()
+	select {
+	case c.queue <- e:
+	default:
+		select {
+		case <-c.queue:
+		default:
+		}
+		select {
+		case c.queue <- e:
+		default:
+		}
+	}
+}
+
+// StageStarted reports that stage has started.
+func (c *Client) StageStarted(stage Stage) {
+	c.send(Event{Type: EventStageStarted, Stage: stage})
+}
+
+// StageFinished reports that stage finished successfully.
+func (c *Client) StageFinished(stage Stage) {
+	c.send(Event{Type: EventStageFinished, Stage: stage})
+}
+
+// Progress reports byte-level progress of stage.
+func (c *Client) Progress(stage Stage, bytes, total int64) {
+	c.send(Event{Type: EventProgress, Stage: stage, Bytes: bytes, Total: total})
+}
+
+// Failure reports that stage failed with err, retryable indicates whether
+// the install can be retried without operator intervention.
+func (c *Client) Failure(stage Stage, err error, retryable bool) {
+	c.send(Event{Type: EventFailure, Stage: stage, Error: err.Error(), Retryable: retryable})
+}
+
+// Neighbors reports LLDP neighbor discovery state for interface, so
+// operators can distinguish "waiting on switch" from "waiting on installer".
+func (c *Client) Neighbors(iface string, waiting bool, neighbors int) {
+	c.send(Event{Type: EventNeighbors, Interface: iface, Waiting: waiting, Neighbors: neighbors})
+}
+
+func (c *Client) run() {
+	batch := make([]Event, 0, batchSize)
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		err := c.post(batch)
+		if err != nil {
+			log.Warn("report: unable to deliver events, dropping batch", "error", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case e := <-c.queue:
+			batch = append(batch, e)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-c.stop:
+			flush()
+			return
+		}
+	}
+}
+
+// post delivers batch, backing off on 5xx responses. It never retries
+// forever: the caller already treats a delivery failure as best-effort.
+func (c *Client) post(batch []Event) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("marshal events failed: %v", err)
+	}
+
+	backoff := minBackoff
+	for attempt := 0; attempt < 3; attempt++ {
+		resp, err := c.httpClient.Post(c.url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("post events failed: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode < 500 {
+			return nil
+		}
+
+		log.Warn("report: metal-core returned server error, backing off", "status", resp.StatusCode, "backoff", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	return fmt.Errorf("post events failed after retries")
+}
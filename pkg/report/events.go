@@ -0,0 +1,60 @@
+// Package report streams structured install progress and events to
+// metal-core, so operators can see where a machine is stuck instead of only
+// having local log15 output and a terminal progress bar.
+package report
+
+// Stage identifies a step of the install process.
+type Stage string
+
+const (
+	// StageWait is waiting for a device create request to be fired
+	StageWait = Stage("wait")
+	// StagePartition is partitioning disks and assembling crypt/raid/lvm volumes
+	StagePartition = Stage("partition")
+	// StagePull is downloading the OS image
+	StagePull = Stage("pull")
+	// StageBurn is extracting the OS image onto disk
+	StageBurn = Stage("burn")
+	// StageInstallSh is running the target OS's install.sh
+	StageInstallSh = Stage("install-sh")
+	// StageBootloader is installing the bootloader
+	StageBootloader = Stage("bootloader")
+	// StageReboot is the final reboot into the installed OS
+	StageReboot = Stage("reboot")
+)
+
+// EventType discriminates the payload carried by an Event.
+type EventType string
+
+const (
+	// EventStageStarted marks the start of a Stage
+	EventStageStarted = EventType("stage-started")
+	// EventStageFinished marks the successful end of a Stage
+	EventStageFinished = EventType("stage-finished")
+	// EventProgress carries byte-level progress of the current Stage
+	EventProgress = EventType("progress")
+	// EventFailure marks a Stage that returned an error
+	EventFailure = EventType("failure")
+	// EventNeighbors carries LLDP neighbor discovery state
+	EventNeighbors = EventType("neighbors")
+)
+
+// Event is a single, typed, JSON-serializable status update.
+type Event struct {
+	Type      EventType `json:"type"`
+	Stage     Stage     `json:"stage,omitempty"`
+	Timestamp int64     `json:"timestamp"`
+
+	// set for EventProgress
+	Bytes int64 `json:"bytes,omitempty"`
+	Total int64 `json:"total,omitempty"`
+
+	// set for EventFailure
+	Error     string `json:"error,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"`
+
+	// set for EventNeighbors
+	Interface string `json:"interface,omitempty"`
+	Waiting   bool   `json:"waiting,omitempty"`
+	Neighbors int    `json:"neighbors,omitempty"`
+}
@@ -0,0 +1,30 @@
+package report
+
+import "io"
+
+// ProxyReader wraps r so every Read also reports byte-level progress of
+// stage to the Client, alongside whatever else r is already wrapped with
+// (e.g. the terminal pb.ProxyReader).
+type ProxyReader struct {
+	io.Reader
+	client *Client
+	stage  Stage
+	total  int64
+	read   int64
+}
+
+// NewProxyReader wraps r, reporting progress of stage against total bytes.
+// client may be nil, in which case it behaves as a plain passthrough.
+func NewProxyReader(r io.Reader, client *Client, stage Stage, total int64) *ProxyReader {
+	return &ProxyReader{Reader: r, client: client, stage: stage, total: total}
+}
+
+// Read implements io.Reader.
+func (p *ProxyReader) Read(b []byte) (int, error) {
+	n, err := p.Reader.Read(b)
+	p.read += int64(n)
+	if p.client != nil {
+		p.client.Progress(p.stage, p.read, p.total)
+	}
+	return n, err
+}